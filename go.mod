@@ -6,6 +6,9 @@ require (
 	gioui.org v0.9.0
 	github.com/bluenviron/gohlslib v1.4.0
 	github.com/bluenviron/gortmplib v0.2.0
+	github.com/bluenviron/mediacommon v1.11.1-0.20240525122142-20163863aa75
+	github.com/bluenviron/mediacommon/v2 v2.6.0
+	golang.org/x/crypto v0.46.0
 )
 
 require (
@@ -13,12 +16,11 @@ require (
 	github.com/abema/go-mp4 v1.4.1 // indirect
 	github.com/asticode/go-astikit v0.30.0 // indirect
 	github.com/asticode/go-astits v1.14.0 // indirect
-	github.com/bluenviron/mediacommon v1.11.1-0.20240525122142-20163863aa75 // indirect
-	github.com/bluenviron/mediacommon/v2 v2.6.0 // indirect
 	github.com/go-text/typesetting v0.3.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	golang.org/x/exp/shiny v0.0.0-20250408133849-7e4ce0ab07d0 // indirect
 	golang.org/x/image v0.26.0 // indirect
+	golang.org/x/net v0.47.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/text v0.32.0 // indirect
 )
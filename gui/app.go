@@ -6,6 +6,7 @@ import (
 	"image/color"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"rtmp_server/internal/config"
@@ -43,13 +44,13 @@ type App struct {
 	window    *app.Window
 	theme     *material.Theme
 	manager   *server.Manager
-	rtmp      *server.RTMPServer
-	http      *server.HTTPServer
+	service   *server.Service
 	dashboard *Dashboard
 	logPanel  *LogPanel
 
 	// Widgets
 	startBtn      widget.Clickable
+	reloadBtn     widget.Clickable
 	mainList      widget.List
 	httpPortInput widget.Editor
 	rtmpPortInput widget.Editor
@@ -59,12 +60,26 @@ type App struct {
 	domainInput   widget.Editor
 	certPathInput widget.Editor
 	keyPathInput  widget.Editor
+	acmeToggle    widget.Bool
+
+	// Config reloaded in the background, applied to inputs on next frame
+	reloadedCfg atomic.Pointer[config.Config]
+	stopWatch   func()
+
+	// Validation errors from the last Start or reload, shown on the inputs
+	configErrors config.ValidationErrors
+
+	// Config profiles; the default profile has an empty name
+	profiles    []string
+	profileBtns map[string]*widget.Clickable
 
 	// State
-	running    bool
-	rtmpAddr   string
-	httpAddr   string
-	sslEnabled bool
+	running     bool
+	rtmpHost    string // Host and port shown in the RTMP URL
+	rtmpListen  bool   // rtmp_listen in config.json overrides the RTMP port
+	httpListen  bool   // http_listen in config.json overrides the HTTP port
+	sslEnabled  bool
+	acmeEnabled bool // Certificates from Let's Encrypt instead of files
 }
 
 // NewApp creates a new application
@@ -80,26 +95,15 @@ func NewApp() *App {
 		},
 	}
 
-	// Load saved config
-	cfg := config.Load()
-
-	// Initialize port inputs with saved values
-	a.httpPortInput.SetText(cfg.HTTPPort)
 	a.httpPortInput.SingleLine = true
-
-	a.rtmpPortInput.SetText(cfg.RTMPPort)
 	a.rtmpPortInput.SingleLine = true
-
-	// Initialize SSL settings
-	a.sslToggle.Value = cfg.SSLEnabled
-	a.sslEnabled = cfg.SSLEnabled
-	a.domainInput.SetText(cfg.SSLDomain)
 	a.domainInput.SingleLine = true
-	a.certPathInput.SetText(cfg.SSLCert)
 	a.certPathInput.SingleLine = true
-	a.keyPathInput.SetText(cfg.SSLKey)
 	a.keyPathInput.SingleLine = true
 
+	// Load saved config of the selected profile
+	a.loadProfile(config.Profile())
+
 	// Configure theme
 	a.theme.Palette.Bg = bgColor
 	a.theme.Palette.Fg = textColor
@@ -147,6 +151,8 @@ func (a *App) eventLoop() error {
 }
 
 func (a *App) layout(gtx layout.Context) layout.Dimensions {
+	a.syncReloadedConfig()
+
 	// Fill background with gradient-like color
 	paint.Fill(gtx.Ops, bgColor)
 
@@ -162,12 +168,25 @@ func (a *App) layout(gtx layout.Context) layout.Dimensions {
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 				return a.layoutStatusCards(gtx)
 			}),
+			layout.Rigid(layout.Spacer{Height: unit.Dp(16)}.Layout),
+			// Resource cards row
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return a.layoutResourceCards(gtx)
+			}),
 			// Spacer
 			layout.Rigid(layout.Spacer{Height: unit.Dp(16)}.Layout),
 			// Config and controls
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 				return a.layoutConfigSection(gtx)
 			}),
+			// Profile selector, if profiles exist
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return a.layoutProfiles(gtx)
+			}),
+			// Configuration errors, if any
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return a.layoutConfigErrors(gtx)
+			}),
 			// Spacer
 			layout.Rigid(layout.Spacer{Height: unit.Dp(12)}.Layout),
 			// SSL Config section
@@ -249,6 +268,32 @@ func (a *App) layoutStatusCards(gtx layout.Context) layout.Dimensions {
 	)
 }
 
+func (a *App) layoutResourceCards(gtx layout.Context) layout.Dimensions {
+	stats := monitor.GetStats()
+	return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceEvenly}.Layout(gtx,
+		// CPU Card
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			cpu := "n/a"
+			if stats.CPUAvailable {
+				cpu = fmt.Sprintf("%.1f%%", stats.CPUPercent)
+			}
+			return a.layoutCard(gtx, "Process CPU", cpu, accentColor)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(16)}.Layout),
+		// Throughput Card
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			network := fmt.Sprintf("↓ %s  ↑ %s", server.FormatBitrate(stats.IngestBps), server.FormatBitrate(stats.EgressBps))
+			return a.layoutCard(gtx, "Ingest / Egress", network, successColor)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(16)}.Layout),
+		// Connections Card
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			conns := fmt.Sprintf("%d RTMP  ·  %d HTTP", stats.RTMPConns, stats.HTTPConns)
+			return a.layoutCard(gtx, "Open Connections", conns, warningColor)
+		}),
+	)
+}
+
 func (a *App) layoutCard(gtx layout.Context, title, value string, valueColor color.NRGBA) layout.Dimensions {
 	return layout.Stack{}.Layout(gtx,
 		// Card background
@@ -297,17 +342,37 @@ func (a *App) layoutConfigSection(gtx layout.Context) layout.Dimensions {
 					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 						return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
 							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-								return a.layoutPortInput(gtx, "RTMP Port", &a.rtmpPortInput, !a.running)
+								label := "RTMP Port"
+								if a.rtmpListen {
+									// The port input is ignored, see rtmp_listen in config.json
+									label = "RTMP Port (rtmp_listen)"
+								}
+								return a.layoutPortInput(gtx, label, "rtmp_port", &a.rtmpPortInput, !a.running && !a.rtmpListen)
 							}),
 							layout.Rigid(layout.Spacer{Width: unit.Dp(32)}.Layout),
 							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-								return a.layoutPortInput(gtx, "HTTP Port", &a.httpPortInput, !a.running)
+								label := "HTTP Port"
+								if a.httpListen {
+									// The port input is ignored, see http_listen in config.json
+									label = "HTTP Port (http_listen)"
+								}
+								return a.layoutPortInput(gtx, label, "http_port", &a.httpPortInput, !a.running && !a.httpListen)
 							}),
 						)
 					}),
-					// Start/Stop button
+					// Reload and Start/Stop buttons
 					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-						return a.layoutStartButton(gtx)
+						return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+								if !a.running {
+									return layout.Dimensions{}
+								}
+								return layout.Inset{Right: unit.Dp(12)}.Layout(gtx, a.layoutReloadButton)
+							}),
+							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+								return a.layoutStartButton(gtx)
+							}),
+						)
 					}),
 				)
 			})
@@ -320,6 +385,10 @@ func (a *App) layoutSSLSection(gtx layout.Context) layout.Dimensions {
 	if a.sslToggle.Update(gtx) {
 		a.sslEnabled = a.sslToggle.Value
 	}
+	if a.acmeToggle.Update(gtx) {
+		a.acmeEnabled = a.acmeToggle.Value
+	}
+	filesEnabled := !a.running && a.sslEnabled && !a.acmeEnabled
 
 	return layout.Stack{}.Layout(gtx,
 		// Background
@@ -354,25 +423,78 @@ func (a *App) layoutSSLSection(gtx layout.Context) layout.Dimensions {
 							}),
 						)
 					}),
+					// ACME toggle
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						if !a.sslEnabled || (a.running && !a.acmeEnabled) {
+							return layout.Dimensions{}
+						}
+						return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+								label := material.Caption(a.theme, "Let's Encrypt")
+								label.Color = textMuted
+								return layout.Inset{Right: unit.Dp(6)}.Layout(gtx, label.Layout)
+							}),
+							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+								if a.running {
+									return layout.Dimensions{}
+								}
+								return material.Switch(a.theme, &a.acmeToggle, "Use Let's Encrypt").Layout(gtx)
+							}),
+						)
+					}),
 					// Domain input
 					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-						return a.layoutSSLInput(gtx, "Domain", &a.domainInput, "example.com", !a.running && a.sslEnabled)
+						return a.layoutSSLInput(gtx, "Domain", "ssl_domain", &a.domainInput, "example.com", !a.running && a.sslEnabled)
 					}),
 					// Cert path
 					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-						return a.layoutSSLInput(gtx, "Cert", &a.certPathInput, "cert.pem", !a.running && a.sslEnabled)
+						return a.layoutSSLInput(gtx, "Cert", "ssl_cert", &a.certPathInput, "cert.pem", filesEnabled)
 					}),
 					// Key path
 					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-						return a.layoutSSLInput(gtx, "Key", &a.keyPathInput, "key.pem", !a.running && a.sslEnabled)
+						return a.layoutSSLInput(gtx, "Key", "ssl_key", &a.keyPathInput, "key.pem", filesEnabled)
 					}),
+					// Certificate expiry
+					layout.Rigid(a.layoutCertExpiry),
 				)
 			})
 		}),
 	)
 }
 
-func (a *App) layoutSSLInput(gtx layout.Context, label string, editor *widget.Editor, hint string, enabled bool) layout.Dimensions {
+// layoutCertExpiry shows when the served certificate expires, highlighted
+// when renewal is due
+func (a *App) layoutCertExpiry(gtx layout.Context) layout.Dimensions {
+	if !a.running || a.service == nil {
+		return layout.Dimensions{}
+	}
+	expiry, ok := a.service.HTTP.CertExpiry()
+	if !ok {
+		if !a.service.HTTP.IsSSL() {
+			return layout.Dimensions{}
+		}
+		// ACME has not issued a certificate yet
+		lbl := material.Caption(a.theme, "Obtaining certificate…")
+		lbl.Color = textMuted
+		return lbl.Layout(gtx)
+	}
+
+	text := "Expires " + expiry.Format("2006-01-02") + " (" + server.FormatExpiry(expiry) + ")"
+	col := successColor
+	if time.Now().After(expiry) {
+		text = "⚠ Certificate expired " + expiry.Format("2006-01-02")
+		col = dangerColor
+	} else if server.CertExpiring(expiry) {
+		text = "⚠ " + text
+		col = warningColor
+	}
+
+	lbl := material.Caption(a.theme, text)
+	lbl.Color = col
+	return lbl.Layout(gtx)
+}
+
+func (a *App) layoutSSLInput(gtx layout.Context, label, field string, editor *widget.Editor, hint string, enabled bool) layout.Dimensions {
 	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 			lbl := material.Caption(a.theme, label)
@@ -389,6 +511,7 @@ func (a *App) layoutSSLInput(gtx layout.Context, label string, editor *widget.Ed
 					bounds := image.Rect(0, 0, gtx.Dp(unit.Dp(120)), gtx.Dp(unit.Dp(32)))
 					rr := gtx.Dp(unit.Dp(6))
 					paint.FillShape(gtx.Ops, bgCol, clip.UniformRRect(bounds, rr).Op(gtx.Ops))
+					a.strokeInvalid(gtx, field, bounds, rr)
 					return layout.Dimensions{Size: image.Point{X: gtx.Dp(unit.Dp(120)), Y: gtx.Dp(unit.Dp(32))}}
 				}),
 				layout.Stacked(func(gtx layout.Context) layout.Dimensions {
@@ -409,7 +532,7 @@ func (a *App) layoutSSLInput(gtx layout.Context, label string, editor *widget.Ed
 	)
 }
 
-func (a *App) layoutPortInput(gtx layout.Context, label string, editor *widget.Editor, enabled bool) layout.Dimensions {
+func (a *App) layoutPortInput(gtx layout.Context, label, field string, editor *widget.Editor, enabled bool) layout.Dimensions {
 	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 			lbl := material.Body2(a.theme, label)
@@ -426,6 +549,7 @@ func (a *App) layoutPortInput(gtx layout.Context, label string, editor *widget.E
 					bounds := image.Rect(0, 0, gtx.Dp(unit.Dp(90)), gtx.Dp(unit.Dp(40)))
 					rr := gtx.Dp(unit.Dp(8))
 					paint.FillShape(gtx.Ops, bgCol, clip.UniformRRect(bounds, rr).Op(gtx.Ops))
+					a.strokeInvalid(gtx, field, bounds, rr)
 					return layout.Dimensions{Size: image.Point{X: gtx.Dp(unit.Dp(90)), Y: gtx.Dp(unit.Dp(40))}}
 				}),
 				layout.Stacked(func(gtx layout.Context) layout.Dimensions {
@@ -442,6 +566,116 @@ func (a *App) layoutPortInput(gtx layout.Context, label string, editor *widget.E
 	)
 }
 
+// strokeInvalid outlines an input in red if its field failed validation
+func (a *App) strokeInvalid(gtx layout.Context, field string, bounds image.Rectangle, rr int) {
+	if a.configErrors.Field(field) == nil {
+		return
+	}
+	paint.FillShape(gtx.Ops, dangerColor, clip.Stroke{
+		Path:  clip.UniformRRect(bounds, rr).Path(gtx.Ops),
+		Width: float32(gtx.Dp(unit.Dp(2))),
+	}.Op())
+}
+
+// layoutProfiles draws a chip per config profile; clicking one while the
+// server is stopped switches to it
+func (a *App) layoutProfiles(gtx layout.Context) layout.Dimensions {
+	if len(a.profiles) == 0 {
+		return layout.Dimensions{}
+	}
+	if a.profileBtns == nil {
+		a.profileBtns = make(map[string]*widget.Clickable)
+	}
+
+	names := append([]string{""}, a.profiles...)
+	children := []layout.FlexChild{
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			label := material.Caption(a.theme, "Profile")
+			label.Color = textMuted
+			return layout.Inset{Right: unit.Dp(8)}.Layout(gtx, label.Layout)
+		}),
+	}
+	for _, name := range names {
+		btn := a.profileBtns[name]
+		if btn == nil {
+			btn = new(widget.Clickable)
+			a.profileBtns[name] = btn
+		}
+		if btn.Clicked(gtx) && !a.running && name != config.Profile() {
+			a.loadProfile(name)
+			logger.Info("Switched to config profile %s", profileLabel(name))
+		}
+
+		label := profileLabel(name)
+		active := name == config.Profile()
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Right: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return btn.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					return a.layoutChip(gtx, label, active)
+				})
+			})
+		}))
+	}
+
+	return layout.Inset{Top: unit.Dp(8), Left: unit.Dp(16)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx, children...)
+	})
+}
+
+// layoutChip draws a small rounded label, highlighted when active
+func (a *App) layoutChip(gtx layout.Context, text string, active bool) layout.Dimensions {
+	bg := inputBgColor
+	fg := textMuted
+	if active {
+		bg = accentColor
+		fg = bgColor
+	}
+
+	return layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx layout.Context) layout.Dimensions {
+			rr := gtx.Dp(unit.Dp(10))
+			paint.FillShape(gtx.Ops, bg, clip.UniformRRect(image.Rectangle{Max: gtx.Constraints.Min}, rr).Op(gtx.Ops))
+			return layout.Dimensions{Size: gtx.Constraints.Min}
+		}),
+		layout.Stacked(func(gtx layout.Context) layout.Dimensions {
+			return layout.Inset{Top: unit.Dp(3), Bottom: unit.Dp(3), Left: unit.Dp(10), Right: unit.Dp(10)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				label := material.Caption(a.theme, text)
+				label.Color = fg
+				return label.Layout(gtx)
+			})
+		}),
+	)
+}
+
+// profileLabel returns the display name of a profile
+func profileLabel(name string) string {
+	if name == "" {
+		return "default"
+	}
+	return name
+}
+
+// layoutConfigErrors lists validation errors below the config section
+func (a *App) layoutConfigErrors(gtx layout.Context) layout.Dimensions {
+	if len(a.configErrors) == 0 {
+		return layout.Dimensions{}
+	}
+
+	children := make([]layout.FlexChild, 0, len(a.configErrors))
+	for _, e := range a.configErrors {
+		msg := "⚠ " + e.Error()
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			label := material.Caption(a.theme, msg)
+			label.Color = dangerColor
+			return label.Layout(gtx)
+		}))
+	}
+
+	return layout.Inset{Top: unit.Dp(8), Left: unit.Dp(16)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+	})
+}
+
 func (a *App) layoutStartButton(gtx layout.Context) layout.Dimensions {
 	// Handle click
 	if a.startBtn.Clicked(gtx) {
@@ -482,6 +716,31 @@ func (a *App) layoutStartButton(gtx layout.Context) layout.Dimensions {
 	)
 }
 
+func (a *App) layoutReloadButton(gtx layout.Context) layout.Dimensions {
+	if a.reloadBtn.Clicked(gtx) {
+		a.reloadConfig()
+	}
+
+	return layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx layout.Context) layout.Dimensions {
+			bounds := image.Rect(0, 0, gtx.Dp(unit.Dp(120)), gtx.Dp(unit.Dp(45)))
+			rr := gtx.Dp(unit.Dp(8))
+			paint.FillShape(gtx.Ops, inputBgColor, clip.UniformRRect(bounds, rr).Op(gtx.Ops))
+			return layout.Dimensions{Size: image.Point{X: gtx.Dp(unit.Dp(120)), Y: gtx.Dp(unit.Dp(45))}}
+		}),
+		layout.Stacked(func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min = image.Point{X: gtx.Dp(unit.Dp(120)), Y: gtx.Dp(unit.Dp(45))}
+			return a.reloadBtn.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Center.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					label := material.Body2(a.theme, "↻  Reload Config")
+					label.Color = textColor
+					return label.Layout(gtx)
+				})
+			})
+		}),
+	)
+}
+
 func (a *App) layoutMainContent(gtx layout.Context) layout.Dimensions {
 	return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceEvenly}.Layout(gtx,
 		// Left: Active Streams
@@ -525,7 +784,7 @@ func (a *App) layoutStreamsPanel(gtx layout.Context) layout.Dimensions {
 						return layout.Center.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 							msg := "Start server to see active streams"
 							if a.running && a.manager != nil && a.manager.StreamCount() == 0 {
-								msg = "Waiting for RTMP streams...\n\nStream URL: rtmp://localhost" + a.rtmpAddr + "/live/{key}"
+								msg = "Waiting for RTMP streams...\n\nStream URL: rtmp://" + a.rtmpHost + "/live/{key}"
 							}
 							label := material.Body2(a.theme, msg)
 							label.Color = textMuted
@@ -596,60 +855,113 @@ func (a *App) start() {
 		sslKey = "key.pem"
 	}
 
-	a.rtmpAddr = ":" + rtmpPort
-	a.httpAddr = "0.0.0.0:" + httpPort
-
-	// Save config for next time (including SSL settings)
-	config.Save(config.Config{
-		HTTPPort:   httpPort,
-		RTMPPort:   rtmpPort,
-		SSLEnabled: a.sslEnabled,
-		SSLDomain:  sslDomain,
-		SSLCert:    sslCert,
-		SSLKey:     sslKey,
-	})
+	// Save config for next time (including SSL settings), keeping
+	// settings that are only editable in config.json. A file that does not
+	// load cleanly is never overwritten, or those settings would be lost.
+	cfg, err := config.Read()
+	if err != nil {
+		a.configErrors = config.AsValidationErrors(err)
+		server.LogConfigErrors("Cannot start server", err)
+		return
+	}
+	cfg.HTTPPort = httpPort
+	cfg.RTMPPort = rtmpPort
+	cfg.SSLEnabled = a.sslEnabled
+	cfg.SSLDomain = sslDomain
+	cfg.SSLCert = sslCert
+	cfg.SSLKey = sslKey
+	cfg.ACMEEnabled = a.sslEnabled && a.acmeEnabled
+
+	// Refuse to start with settings that would fail later
+	if err := config.Validate(cfg); err != nil {
+		a.configErrors = config.AsValidationErrors(err)
+		server.LogConfigErrors("Cannot start server", err)
+		return
+	}
+	a.configErrors = nil
+	if err := config.Save(cfg); err != nil {
+		logger.Warn("Could not save %s: %v", config.GetConfigPath(), err)
+	}
 
 	// Create new servers with configured ports
-	a.manager = server.NewManager("./hls")
-	a.rtmp = server.NewRTMPServer(a.rtmpAddr, a.manager)
-	a.http = server.NewHTTPServer(a.httpAddr, a.manager)
+	a.service = server.NewService(cfg)
+	a.manager = a.service.Manager
+	a.rtmpHost = a.service.RTMPHost()
 
-	// Set dashboard display URL
-	displayHost := "localhost:" + httpPort
-	if sslDomain != "" && a.sslEnabled {
-		displayHost = sslDomain
+	a.dashboard = NewDashboard(a.service)
+
+	if err := a.service.Start(); err != nil {
+		logger.Error("Failed to start server: %v", err)
+		return
 	}
-	a.dashboard = NewDashboard(a.manager, displayHost)
 
-	logger.Info("Starting streaming server...")
+	// Pick up config file changes and SIGHUP without restarting
+	a.service.OnReload(func(cfg config.Config) {
+		a.reloadedCfg.Store(&cfg)
+		a.window.Invalidate()
+	})
+	a.stopWatch = a.service.WatchConfig()
 
-	if err := a.rtmp.Start(); err != nil {
-		logger.Error("Failed to start RTMP server: %v", err)
+	a.running = true
+}
+
+// reloadConfig re-reads config.json and applies it to the running servers
+// without dropping live streams
+func (a *App) reloadConfig() {
+	if !a.running {
 		return
 	}
 
-	// Start HTTP server with or without SSL
-	var httpErr error
-	if a.sslEnabled {
-		httpErr = a.http.StartWithTLS(sslCert, sslKey)
-	} else {
-		httpErr = a.http.Start()
+	cfg, err := config.ReadValid()
+	if err != nil {
+		a.configErrors = config.AsValidationErrors(err)
+		server.LogConfigErrors("Keeping current configuration", err)
+		return
 	}
+	a.configErrors = nil
+	a.service.Reload(cfg)
+}
 
-	if httpErr != nil {
-		logger.Error("Failed to start HTTP server: %v", httpErr)
-		a.rtmp.Stop()
+// syncReloadedConfig shows a configuration reloaded in the background in
+// the inputs, so the next Start does not save stale values
+func (a *App) syncReloadedConfig() {
+	cfg := a.reloadedCfg.Swap(nil)
+	if cfg == nil {
 		return
 	}
 
-	a.running = true
-	logger.Info("✅ Server started successfully")
-	logger.Info("📡 RTMP URL: rtmp://localhost%s/live/{stream_key}", a.rtmpAddr)
-	if a.sslEnabled {
-		logger.Info("🔒 HLS URL:  https://%s/live/{stream_key}/index.m3u8", displayHost)
+	a.setInputs(*cfg)
+	a.rtmpHost = a.service.RTMPHost()
+}
+
+// setInputs shows cfg in the port and SSL inputs
+func (a *App) setInputs(cfg config.Config) {
+	a.httpPortInput.SetText(cfg.HTTPPort)
+	a.rtmpPortInput.SetText(cfg.RTMPPort)
+	a.rtmpListen = len(cfg.RTMPListen) > 0
+	a.httpListen = len(cfg.HTTPListen) > 0
+	a.sslToggle.Value = cfg.SSLEnabled
+	a.sslEnabled = cfg.SSLEnabled
+	a.acmeToggle.Value = cfg.ACMEEnabled
+	a.acmeEnabled = cfg.ACMEEnabled
+	a.domainInput.SetText(cfg.SSLDomain)
+	a.certPathInput.SetText(cfg.SSLCert)
+	a.keyPathInput.SetText(cfg.SSLKey)
+}
+
+// loadProfile selects a config profile and shows its settings
+func (a *App) loadProfile(name string) {
+	config.SetProfile(name)
+	a.profiles = config.Profiles()
+
+	cfg, err := config.Read()
+	a.configErrors = config.AsValidationErrors(err)
+	if err != nil {
+		server.LogConfigErrors("Cannot read "+config.GetConfigPath(), err)
 	} else {
-		logger.Info("🎬 HLS URL:  http://localhost:%s/live/{stream_key}/index.m3u8", httpPort)
+		server.ApplyLogConfig(cfg)
 	}
+	a.setInputs(cfg)
 }
 
 func (a *App) stop() {
@@ -657,12 +969,10 @@ func (a *App) stop() {
 		return
 	}
 
-	logger.Info("Stopping server...")
-	a.http.Stop()
-	a.rtmp.Stop()
+	a.stopWatch()
+	a.service.Stop()
 	a.running = false
 	a.dashboard = nil
-	logger.Info("⏹  Server stopped")
 }
 
 // Main entry point
@@ -671,8 +981,10 @@ func Main() {
 		a := NewApp()
 		if err := a.Run(); err != nil {
 			logger.Error("Application error: %v", err)
+			logger.CloseFile()
 			os.Exit(1)
 		}
+		logger.CloseFile()
 		os.Exit(0)
 	}()
 	app.Main()
@@ -4,15 +4,21 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"io"
+	"slices"
+	"strings"
 	"time"
 
+	"rtmp_server/internal/logger"
 	"rtmp_server/server"
 
 	"gioui.org/font"
+	"gioui.org/io/clipboard"
 	"gioui.org/layout"
 	"gioui.org/op/clip"
 	"gioui.org/op/paint"
 	"gioui.org/unit"
+	"gioui.org/widget"
 	"gioui.org/widget/material"
 )
 
@@ -21,29 +27,68 @@ var (
 	colorLive    = color.NRGBA{R: 50, G: 205, B: 50, A: 255}   // Green
 	colorOffline = color.NRGBA{R: 128, G: 128, B: 128, A: 255} // Gray
 	colorCard    = color.NRGBA{R: 35, G: 35, B: 55, A: 255}    // Dark card bg
+	colorAlert   = color.NRGBA{R: 90, G: 30, B: 40, A: 255}    // Card bg of an unhealthy stream
 	colorText    = color.NRGBA{R: 230, G: 230, B: 230, A: 255} // Light text
 	colorSubtext = color.NRGBA{R: 150, G: 150, B: 170, A: 255} // Muted text
 	colorAccent  = color.NRGBA{R: 100, G: 150, B: 255, A: 255} // Blue accent
+
+	colorSparkBase   = color.NRGBA{R: 60, G: 60, B: 85, A: 255} // Sparkline baseline
+	colorButton      = color.NRGBA{R: 50, G: 50, B: 75, A: 255} // Card button bg
+	colorButtonHover = color.NRGBA{R: 65, G: 65, B: 95, A: 255}
 )
 
+// noticeDuration is how long feedback such as "Copied" stays visible
+const noticeDuration = 2 * time.Second
+
+// kickConfirmWindow is how long the disconnect button waits for the
+// confirming second click
+const kickConfirmWindow = 3 * time.Second
+
 // Dashboard displays stream status
 type Dashboard struct {
+	service     *server.Service
 	manager     *server.Manager
-	httpAddr    string
 	lastRefresh time.Time
+
+	// Card buttons by stream key
+	cards map[string]*cardWidgets
+
+	// Detail view of one stream; empty shows the stream list
+	detail     string
+	detailLogs *LogPanel
+	backBtn    widget.Clickable
+
+	// Short feedback after an action
+	notice   string
+	noticeAt time.Time
+}
+
+// cardWidgets holds the buttons of one stream card
+type cardWidgets struct {
+	copyHLS   widget.Clickable
+	copyRTMP  widget.Clickable
+	kick      widget.Clickable
+	details   widget.Clickable
+	kickArmed time.Time // First click on kick, awaiting confirmation
 }
 
 // NewDashboard creates a new dashboard
-func NewDashboard(manager *server.Manager, httpAddr string) *Dashboard {
+func NewDashboard(service *server.Service) *Dashboard {
 	return &Dashboard{
-		manager:  manager,
-		httpAddr: httpAddr,
+		service: service,
+		manager: service.Manager,
+		cards:   make(map[string]*cardWidgets),
 	}
 }
 
 // Layout draws the dashboard
 func (d *Dashboard) Layout(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	if d.detail != "" {
+		return d.layoutDetail(gtx, th)
+	}
+
 	streams := d.manager.GetAllStreams()
+	d.forgetCards(streams)
 
 	if len(streams) == 0 {
 		return d.layoutEmpty(gtx, th)
@@ -58,97 +103,74 @@ func (d *Dashboard) Layout(gtx layout.Context, th *material.Theme) layout.Dimens
 				return label.Layout(gtx)
 			})
 		}),
+		// Feedback from the card buttons
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return d.layoutNotice(gtx, th)
+		}),
 		// Stream cards
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
-				childrenFromStreams(gtx, th, streams, d.httpAddr)...,
+				d.childrenFromStreams(gtx, th, streams)...,
 			)
 		}),
 	)
 }
 
-func childrenFromStreams(gtx layout.Context, th *material.Theme, streams []server.StreamInfo, httpAddr string) []layout.FlexChild {
+func (d *Dashboard) childrenFromStreams(gtx layout.Context, th *material.Theme, streams []server.StreamInfo) []layout.FlexChild {
 	children := make([]layout.FlexChild, len(streams))
 	for i, stream := range streams {
 		s := stream // Capture
+		history, _ := d.manager.StreamHistory(s.Key, sparklineSamples)
 		children[i] = layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-			return layoutStreamCard(gtx, th, s, httpAddr)
+			return d.layoutStreamCard(gtx, th, s, history)
 		})
 	}
 	return children
 }
 
-func layoutStreamCard(gtx layout.Context, th *material.Theme, stream server.StreamInfo, httpAddr string) layout.Dimensions {
+func (d *Dashboard) layoutStreamCard(gtx layout.Context, th *material.Theme, stream server.StreamInfo, history []server.StreamSample) layout.Dimensions {
+	w := d.card(stream.Key)
+	d.handleCardActions(gtx, stream, w)
+
 	return layout.Inset{Bottom: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 		// Card background
 		return layout.Stack{}.Layout(gtx,
 			layout.Expanded(func(gtx layout.Context) layout.Dimensions {
-				bounds := image.Rect(0, 0, gtx.Constraints.Max.X, gtx.Dp(unit.Dp(80)))
+				// Sized to the card content
+				bounds := image.Rect(0, 0, gtx.Constraints.Max.X, gtx.Constraints.Min.Y)
 				rr := gtx.Dp(unit.Dp(8))
-				paint.FillShape(gtx.Ops, colorCard,
+				bg := colorCard
+				if len(stream.Alerts) > 0 {
+					bg = colorAlert
+				}
+				paint.FillShape(gtx.Ops, bg,
 					clip.UniformRRect(bounds, rr).Op(gtx.Ops))
-				return layout.Dimensions{Size: image.Point{X: gtx.Constraints.Max.X, Y: gtx.Dp(unit.Dp(80))}}
+				return layout.Dimensions{Size: bounds.Max}
 			}),
 			layout.Stacked(func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
 				return layout.UniformInset(unit.Dp(12)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
-					return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceBetween}.Layout(gtx,
-						// Left side: status and name
+					return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return layoutStreamSummary(gtx, th, stream, d.service.HLSURL(stream.Key))
+						}),
+						layout.Rigid(layout.Spacer{Height: unit.Dp(6)}.Layout),
 						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-							return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
-								// Stream name with status indicator
-								layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-									return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
-										// Status dot
-										layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-											size := gtx.Dp(unit.Dp(10))
-											bounds := image.Rect(0, 0, size, size)
-											statusColor := colorLive
-											if !stream.Active {
-												statusColor = colorOffline
-											}
-											paint.FillShape(gtx.Ops, statusColor,
-												clip.Ellipse(bounds).Op(gtx.Ops))
-											return layout.Dimensions{Size: image.Point{X: size, Y: size}}
-										}),
-										layout.Rigid(layout.Spacer{Width: unit.Dp(8)}.Layout),
-										// Stream key
-										layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-											label := material.Body1(th, stream.Key)
-											label.Color = colorText
-											label.Font.Weight = font.SemiBold
-											return label.Layout(gtx)
-										}),
-									)
-								}),
-								layout.Rigid(layout.Spacer{Height: unit.Dp(4)}.Layout),
-								// Duration
-								layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-									duration := time.Since(stream.StartTime)
-									label := material.Body2(th, "⏱ "+server.FormatDuration(duration))
-									label.Color = colorSubtext
-									return label.Layout(gtx)
-								}),
-							)
+							return layoutStreamStats(gtx, th, stream.Stats)
 						}),
-						// Right side: bitrate and URL
+						layout.Rigid(layout.Spacer{Height: unit.Dp(6)}.Layout),
 						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-							return layout.Flex{Axis: layout.Vertical, Alignment: layout.End}.Layout(gtx,
-								// Bitrate
-								layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-									label := material.Body1(th, "📊 "+server.FormatBitrate(stream.Bitrate))
-									label.Color = colorAccent
-									label.Font.Weight = font.Medium
-									return label.Layout(gtx)
-								}),
-								layout.Rigid(layout.Spacer{Height: unit.Dp(4)}.Layout),
-								// HLS URL
-								layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-									url := fmt.Sprintf("http://%s/live/%s/index.m3u8", httpAddr, stream.Key)
-									label := material.Caption(th, url)
-									label.Color = colorSubtext
-									return label.Layout(gtx)
-								}),
-							)
+							return layoutStreamHistory(gtx, th, history)
+						}),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return layoutStreamAlerts(gtx, th, stream.Alerts)
+						}),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return layoutStreamRelays(gtx, th, stream.Relays)
+						}),
+						layout.Rigid(layout.Spacer{Height: unit.Dp(8)}.Layout),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return d.layoutCardButtons(gtx, th, w)
 						}),
 					)
 				})
@@ -157,6 +179,318 @@ func layoutStreamCard(gtx layout.Context, th *material.Theme, stream server.Stre
 	})
 }
 
+// layoutStreamSummary draws the stream name, uptime, bitrate and URL
+func layoutStreamSummary(gtx layout.Context, th *material.Theme, stream server.StreamInfo, hlsURL string) layout.Dimensions {
+	return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceBetween}.Layout(gtx,
+		// Left side: status and name
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				// Stream name with status indicator
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						// Status dot
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							size := gtx.Dp(unit.Dp(10))
+							bounds := image.Rect(0, 0, size, size)
+							statusColor := colorLive
+							if !stream.Active {
+								statusColor = colorOffline
+							}
+							paint.FillShape(gtx.Ops, statusColor,
+								clip.Ellipse(bounds).Op(gtx.Ops))
+							return layout.Dimensions{Size: image.Point{X: size, Y: size}}
+						}),
+						layout.Rigid(layout.Spacer{Width: unit.Dp(8)}.Layout),
+						// Stream key
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							label := material.Body1(th, stream.Key)
+							label.Color = colorText
+							label.Font.Weight = font.SemiBold
+							return label.Layout(gtx)
+						}),
+					)
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(4)}.Layout),
+				// Duration
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					duration := time.Since(stream.StartTime)
+					label := material.Body2(th, "⏱ "+server.FormatDuration(duration))
+					label.Color = colorSubtext
+					return label.Layout(gtx)
+				}),
+			)
+		}),
+		// Right side: bitrate and URL
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Vertical, Alignment: layout.End}.Layout(gtx,
+				// Bitrate
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					label := material.Body1(th, fmt.Sprintf("📊 %s  👁 %d", server.FormatBitrate(stream.Bitrate), stream.Viewers))
+					label.Color = colorAccent
+					label.Font.Weight = font.Medium
+					return label.Layout(gtx)
+				}),
+				layout.Rigid(layout.Spacer{Height: unit.Dp(4)}.Layout),
+				// HLS URL
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					label := material.Caption(th, hlsURL)
+					label.Color = colorSubtext
+					return label.Layout(gtx)
+				}),
+			)
+		}),
+	)
+}
+
+// layoutStreamStats draws the encoder timing statistics, highlighting
+// timestamp problems and segments that overrun the target
+func layoutStreamStats(gtx layout.Context, th *material.Theme, stats server.StreamStats) layout.Dimensions {
+	gop := "GOP –"
+	if stats.GOPLength > 0 {
+		gop = fmt.Sprintf("GOP %d (%.1fs)", stats.GOPLength, stats.KeyframeInterval.Seconds())
+	}
+	text := fmt.Sprintf("🎞 %.1f fps  ·  %s  ·  A/V %+dms", stats.FPS, gop, stats.AVDrift.Milliseconds())
+	if stats.Segments > 0 {
+		text += fmt.Sprintf("  ·  Seg %.1fs avg / %.1fs max", stats.SegmentAvg.Seconds(), stats.SegmentMax.Seconds())
+	}
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutTimingStats(gtx, th, stats, text)
+		}),
+		// Keyframe advice when segments run long
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			hint := server.KeyframeHint(stats)
+			if hint == "" {
+				return layout.Dimensions{}
+			}
+			return layout.Inset{Top: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				label := material.Caption(th, "⚠ "+hint)
+				label.Color = colorWarn
+				return label.Layout(gtx)
+			})
+		}),
+	)
+}
+
+// layoutTimingStats draws the statistics line followed by timestamp
+// error counts, if any
+func layoutTimingStats(gtx layout.Context, th *material.Theme, stats server.StreamStats, text string) layout.Dimensions {
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			label := material.Caption(th, text)
+			label.Color = colorSubtext
+			return label.Layout(gtx)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if stats.Discontinuities == 0 && stats.DTSErrors == 0 {
+				return layout.Dimensions{}
+			}
+			label := material.Caption(th, fmt.Sprintf("  ·  ⚠ %d discontinuities, %d DTS errors", stats.Discontinuities, stats.DTSErrors))
+			label.Color = colorWarn
+			return label.Layout(gtx)
+		}),
+	)
+}
+
+// layoutStreamAlerts lists the watchdog alerts of a stream
+func layoutStreamAlerts(gtx layout.Context, th *material.Theme, alerts []server.Alert) layout.Dimensions {
+	if len(alerts) == 0 {
+		return layout.Dimensions{}
+	}
+	text := ""
+	for i, a := range alerts {
+		if i > 0 {
+			text += "  ·  "
+		}
+		text += server.FormatAlert(a)
+	}
+	return layout.Inset{Top: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		label := material.Body2(th, "🚨 "+text)
+		label.Color = colorWarn
+		label.Font.Weight = font.SemiBold
+		return label.Layout(gtx)
+	})
+}
+
+// layoutStreamRelays lists the push targets of a stream with their state
+func layoutStreamRelays(gtx layout.Context, th *material.Theme, relays []server.RelayStatus) layout.Dimensions {
+	if len(relays) == 0 {
+		return layout.Dimensions{}
+	}
+	children := make([]layout.FlexChild, len(relays))
+	for i, r := range relays {
+		text, fg := relayLine(r)
+		children[i] = layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			label := material.Caption(th, text)
+			label.Color = fg
+			label.MaxLines = 1
+			return label.Layout(gtx)
+		})
+	}
+	return layout.Inset{Top: unit.Dp(6)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+	})
+}
+
+// relayLine describes a push target on one line, e.g.
+// "⇪ rtmp://host/live/abcd…  ·  connected  ·  2.5 Mbps"
+func relayLine(r server.RelayStatus) (string, color.NRGBA) {
+	text := fmt.Sprintf("⇪ %s  ·  %s", r.URL, r.State)
+	switch r.State {
+	case server.RelayConnected:
+		return text + "  ·  " + server.FormatBitrate(r.Bitrate), colorLive
+	case server.RelayRetrying:
+		wait := max(time.Until(r.RetryAt), 0).Round(time.Second)
+		return fmt.Sprintf("%s in %s: %s", text, wait, r.LastError), colorWarn
+	default:
+		return text, colorSubtext
+	}
+}
+
+// layoutStreamHistory draws a bitrate sparkline of the last five minutes
+// with the peak bitrate next to it
+func layoutStreamHistory(gtx layout.Context, th *material.Theme, history []server.StreamSample) layout.Dimensions {
+	values := make([]float64, len(history))
+	var peak int64
+	for i, s := range history {
+		values[i] = float64(s.Bitrate)
+		peak = max(peak, s.Bitrate)
+	}
+
+	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.End}.Layout(gtx,
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			return layoutSparkline(gtx, values, unit.Dp(28), colorAccent)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(12)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			label := material.Caption(th, "5 min  ·  peak "+server.FormatBitrate(peak))
+			label.Color = colorSubtext
+			return label.Layout(gtx)
+		}),
+	)
+}
+
+// card returns the buttons of a stream card, creating them on first use
+func (d *Dashboard) card(key string) *cardWidgets {
+	w := d.cards[key]
+	if w == nil {
+		w = new(cardWidgets)
+		d.cards[key] = w
+	}
+	return w
+}
+
+// forgetCards drops the buttons of streams that are gone
+func (d *Dashboard) forgetCards(streams []server.StreamInfo) {
+	for key := range d.cards {
+		if !slices.ContainsFunc(streams, func(s server.StreamInfo) bool { return s.Key == key }) {
+			delete(d.cards, key)
+		}
+	}
+}
+
+// handleCardActions runs the actions of the card buttons clicked since the
+// last frame
+func (d *Dashboard) handleCardActions(gtx layout.Context, stream server.StreamInfo, w *cardWidgets) {
+	if w.copyHLS.Clicked(gtx) {
+		copyToClipboard(gtx, d.service.HLSURL(stream.Key))
+		d.showNotice("Copied HLS URL of " + stream.Key)
+	}
+	if w.copyRTMP.Clicked(gtx) {
+		app := ""
+		if details, ok := d.manager.StreamDetails(stream.Key); ok {
+			app = details.App
+		}
+		copyToClipboard(gtx, d.service.RTMPURL(app, stream.Key))
+		d.showNotice("Copied RTMP URL of " + stream.Key)
+	}
+	if w.kick.Clicked(gtx) {
+		// Disconnecting takes a second click to confirm
+		if time.Since(w.kickArmed) > kickConfirmWindow {
+			w.kickArmed = time.Now()
+		} else {
+			w.kickArmed = time.Time{}
+			if err := d.manager.DisconnectPublisher(stream.Key); err != nil {
+				logger.Warn("Could not disconnect publisher of %s: %v", stream.Key, err)
+			}
+		}
+	}
+	if w.details.Clicked(gtx) {
+		d.openDetail(stream.Key)
+	}
+}
+
+// layoutCardButtons draws the action buttons of a stream card
+func (d *Dashboard) layoutCardButtons(gtx layout.Context, th *material.Theme, w *cardWidgets) layout.Dimensions {
+	kickText, kickColor := "⏏ Disconnect", colorSubtext
+	if time.Since(w.kickArmed) <= kickConfirmWindow {
+		kickText, kickColor = "⏏ Click again to disconnect", colorError
+	}
+	return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutCardButton(gtx, th, &w.copyHLS, "📋 HLS URL", colorSubtext)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(6)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutCardButton(gtx, th, &w.copyRTMP, "📋 RTMP URL", colorSubtext)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(6)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutCardButton(gtx, th, &w.details, "🔎 Details", colorSubtext)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(6)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutCardButton(gtx, th, &w.kick, kickText, kickColor)
+		}),
+	)
+}
+
+// layoutCardButton draws a small button with a rounded background
+func layoutCardButton(gtx layout.Context, th *material.Theme, btn *widget.Clickable, text string, fg color.NRGBA) layout.Dimensions {
+	return btn.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Stack{}.Layout(gtx,
+			layout.Expanded(func(gtx layout.Context) layout.Dimensions {
+				bg := colorButton
+				if btn.Hovered() {
+					bg = colorButtonHover
+				}
+				rr := gtx.Dp(unit.Dp(6))
+				paint.FillShape(gtx.Ops, bg, clip.UniformRRect(image.Rectangle{Max: gtx.Constraints.Min}, rr).Op(gtx.Ops))
+				return layout.Dimensions{Size: gtx.Constraints.Min}
+			}),
+			layout.Stacked(func(gtx layout.Context) layout.Dimensions {
+				return layout.Inset{Top: unit.Dp(4), Bottom: unit.Dp(4), Left: unit.Dp(8), Right: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+					label := material.Caption(th, text)
+					label.Color = fg
+					return label.Layout(gtx)
+				})
+			}),
+		)
+	})
+}
+
+// copyToClipboard puts text on the system clipboard
+func copyToClipboard(gtx layout.Context, text string) {
+	gtx.Execute(clipboard.WriteCmd{Type: "application/text", Data: io.NopCloser(strings.NewReader(text))})
+}
+
+// showNotice shows brief feedback above the stream cards
+func (d *Dashboard) showNotice(text string) {
+	d.notice, d.noticeAt = text, time.Now()
+}
+
+func (d *Dashboard) layoutNotice(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	if d.notice == "" || time.Since(d.noticeAt) > noticeDuration {
+		return layout.Dimensions{}
+	}
+	return layout.Inset{Bottom: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		label := material.Caption(th, "✔ "+d.notice)
+		label.Color = colorLive
+		return label.Layout(gtx)
+	})
+}
+
 func (d *Dashboard) layoutEmpty(gtx layout.Context, th *material.Theme) layout.Dimensions {
 	return layout.Center.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 		return layout.Flex{Axis: layout.Vertical, Alignment: layout.Middle}.Layout(gtx,
@@ -0,0 +1,141 @@
+package gui
+
+import (
+	"fmt"
+	"time"
+
+	"rtmp_server/server"
+
+	"gioui.org/font"
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+)
+
+// openDetail switches the dashboard to the detail view of a stream
+func (d *Dashboard) openDetail(key string) {
+	d.detail = key
+	d.detailLogs = NewLogPanel()
+	d.detailLogs.Stream = key
+}
+
+// closeDetail returns to the stream list
+func (d *Dashboard) closeDetail() {
+	d.detail = ""
+	d.detailLogs.Close()
+	d.detailLogs = nil
+}
+
+// layoutDetail draws codec parameters, connection info and the log
+// entries of one stream
+func (d *Dashboard) layoutDetail(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	if d.backBtn.Clicked(gtx) {
+		d.closeDetail()
+		return d.Layout(gtx, th)
+	}
+
+	details, active := d.manager.StreamDetails(d.detail)
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		// Back button and stream key
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layoutCardButton(gtx, th, &d.backBtn, "← Back", colorText)
+				}),
+				layout.Rigid(layout.Spacer{Width: unit.Dp(12)}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					label := material.H6(th, "🔎 "+d.detail)
+					label.Color = colorText
+					return label.Layout(gtx)
+				}),
+			)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(12)}.Layout),
+		// Stream and publisher
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if !active {
+				label := material.Body2(th, "The stream is no longer active.")
+				label.Color = colorSubtext
+				return label.Layout(gtx)
+			}
+			return d.layoutDetailInfo(gtx, th, details)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(12)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			label := material.Body2(th, "Stream log")
+			label.Color = colorText
+			label.Font.Weight = font.SemiBold
+			return label.Layout(gtx)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(6)}.Layout),
+		// Log entries of this stream
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			return d.detailLogs.Layout(gtx, th)
+		}),
+	)
+}
+
+func (d *Dashboard) layoutDetailInfo(gtx layout.Context, th *material.Theme, details server.StreamDetails) layout.Dimensions {
+	orNone := func(s string) string {
+		if s == "" {
+			return "none"
+		}
+		return s
+	}
+	publisher := details.Remote
+	if details.ConnID != 0 {
+		publisher = fmt.Sprintf("%s (conn %d)", details.Remote, details.ConnID)
+	}
+	connected := "–"
+	if !details.ConnectedAt.IsZero() {
+		connected = fmt.Sprintf("%s (%s ago)", details.ConnectedAt.Format("2006-01-02 15:04:05"),
+			server.FormatDuration(time.Since(details.ConnectedAt)))
+	}
+
+	rows := [][2]string{
+		{"HLS URL", d.service.HLSURL(details.Key)},
+		{"RTMP URL", d.service.RTMPURL(details.App, details.Key)},
+		{"Publisher", publisher},
+		{"Connected", connected},
+		{"Video", orNone(details.Video)},
+		{"Audio", orNone(details.Audio)},
+		{"Bitrate", fmt.Sprintf("%s, %d viewer(s)", server.FormatBitrate(details.Bitrate), details.Viewers)},
+	}
+
+	children := make([]layout.FlexChild, 0, len(rows)+2)
+	for _, row := range rows {
+		children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutDetailRow(gtx, th, row[0], row[1])
+		}))
+	}
+	children = append(children,
+		layout.Rigid(layout.Spacer{Height: unit.Dp(6)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutStreamStats(gtx, th, details.Stats)
+		}),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutStreamAlerts(gtx, th, details.Alerts)
+		}),
+	)
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+}
+
+// layoutDetailRow draws one "name: value" line of the detail view
+func layoutDetailRow(gtx layout.Context, th *material.Theme, name, value string) layout.Dimensions {
+	return layout.Inset{Bottom: unit.Dp(3)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Min.X = gtx.Dp(unit.Dp(80))
+				label := material.Body2(th, name)
+				label.Color = colorSubtext
+				return label.Layout(gtx)
+			}),
+			layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+				label := material.Body2(th, value)
+				label.Color = colorText
+				return label.Layout(gtx)
+			}),
+		)
+	})
+}
@@ -1,8 +1,12 @@
 package gui
 
 import (
+	"fmt"
 	"image"
 	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"rtmp_server/internal/logger"
@@ -19,32 +23,113 @@ import (
 
 // Colors for log levels
 var (
+	colorDebug = color.NRGBA{R: 170, G: 140, B: 220, A: 255} // Lavender
 	colorInfo  = color.NRGBA{R: 130, G: 200, B: 255, A: 255} // Light blue
 	colorWarn  = color.NRGBA{R: 255, G: 200, B: 100, A: 255} // Orange
 	colorError = color.NRGBA{R: 255, G: 100, B: 100, A: 255} // Red
 	colorTime  = color.NRGBA{R: 150, G: 150, B: 150, A: 255} // Gray
 )
 
+// logQueue is the number of new entries held for the panel between frames
+// before further ones are read back from the log buffer
+const logQueue = 256
+
+// logLevels are the levels with a toggle in the toolbar, least severe first
+var logLevels = []logger.LogLevel{logger.LevelDebug, logger.LevelInfo, logger.LevelWarn, logger.LevelError}
+
 // LogPanel displays real-time logs
 type LogPanel struct {
 	list widget.List
+
+	// Stream limits the panel to entries of one stream when set
+	Stream string
+
+	// The newest entries, kept up to date from a log subscription
+	sub *logger.Subscription
+	log []logger.Entry
+
+	// Filters
+	hidden      map[logger.LogLevel]bool
+	levelBtns   map[logger.LogLevel]*widget.Clickable
+	search      widget.Editor
+	streamInput widget.Editor
+
+	// While paused the panel shows the entries as they were when pausing
+	paused   bool
+	frozen   []logger.Entry
+	pauseBtn widget.Clickable
+
+	exportTextBtn widget.Clickable
+	exportJSONBtn widget.Clickable
+
+	// Result of the last export
+	notice   string
+	noticeAt time.Time
 }
 
 // NewLogPanel creates a new log panel
 func NewLogPanel() *LogPanel {
-	return &LogPanel{
+	lp := &LogPanel{
 		list: widget.List{
 			List: layout.List{
-				Axis: layout.Vertical,
+				Axis:        layout.Vertical,
+				ScrollToEnd: true,
 			},
 		},
+		hidden:    make(map[logger.LogLevel]bool),
+		levelBtns: make(map[logger.LogLevel]*widget.Clickable),
+	}
+	for _, level := range logLevels {
+		lp.levelBtns[level] = new(widget.Clickable)
+	}
+	lp.sub, lp.log = logger.Subscribe(0, logQueue)
+	lp.search.SingleLine = true
+	lp.streamInput.SingleLine = true
+	return lp
+}
+
+// Close stops the panel from receiving new entries
+func (lp *LogPanel) Close() {
+	lp.sub.Close()
+}
+
+// receive appends the entries logged since the last frame
+func (lp *LogPanel) receive() {
+	for {
+		select {
+		case e, ok := <-lp.sub.C:
+			if !ok {
+				return
+			}
+			lp.log = append(lp.log, lp.sub.WithMissed(e)...)
+		default:
+			if over := len(lp.log) - logger.MaxEntries; over > 0 {
+				lp.log = lp.log[over:]
+			}
+			return
+		}
 	}
 }
 
 // Layout draws the log panel
 func (lp *LogPanel) Layout(gtx layout.Context, th *material.Theme) layout.Dimensions {
-	entries := logger.GetLogs()
+	lp.receive()
+	lp.handleToolbar(gtx)
+	entries := lp.entries()
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return lp.layoutToolbar(gtx, th)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(6)}.Layout),
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			return lp.layoutEntries(gtx, th, entries)
+		}),
+	)
+}
 
+// layoutEntries draws the entries in a scrolling list
+func (lp *LogPanel) layoutEntries(gtx layout.Context, th *material.Theme, entries []logger.Entry) layout.Dimensions {
 	// Container with dark background
 	return layout.Stack{}.Layout(gtx,
 		// Background
@@ -58,7 +143,11 @@ func (lp *LogPanel) Layout(gtx layout.Context, th *material.Theme) layout.Dimens
 		layout.Stacked(func(gtx layout.Context) layout.Dimensions {
 			return layout.UniformInset(unit.Dp(8)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 				if len(entries) == 0 {
-					label := material.Body2(th, "No logs yet...")
+					msg := "No logs yet..."
+					if lp.filtering() {
+						msg = "No entries match the filters"
+					}
+					label := material.Body2(th, msg)
 					label.Color = colorTime
 					return label.Layout(gtx)
 				}
@@ -72,6 +161,141 @@ func (lp *LogPanel) Layout(gtx layout.Context, th *material.Theme) layout.Dimens
 	)
 }
 
+// handleToolbar applies the toolbar buttons clicked since the last frame
+func (lp *LogPanel) handleToolbar(gtx layout.Context) {
+	for _, level := range logLevels {
+		if lp.levelBtns[level].Clicked(gtx) {
+			lp.hidden[level] = !lp.hidden[level]
+		}
+	}
+	if lp.pauseBtn.Clicked(gtx) {
+		lp.paused = !lp.paused
+		// New entries are only appended to lp.log, so the frozen slice
+		// stays as it is without a copy
+		lp.frozen = nil
+		if lp.paused {
+			lp.frozen = lp.log
+		}
+		lp.list.ScrollToEnd = !lp.paused
+	}
+	if lp.exportTextBtn.Clicked(gtx) {
+		lp.export(logger.FormatText)
+	}
+	if lp.exportJSONBtn.Clicked(gtx) {
+		lp.export(logger.FormatJSON)
+	}
+}
+
+// layoutToolbar draws the level toggles, pause and export buttons, and
+// the search and stream inputs
+func (lp *LogPanel) layoutToolbar(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	pauseText := "⏸ Pause"
+	if lp.paused {
+		pauseText = "▶ Resume"
+	}
+
+	buttons := make([]layout.FlexChild, 0, 2*len(logLevels)+6)
+	for _, level := range logLevels {
+		fg := levelColor(level)
+		if lp.hidden[level] {
+			fg = colorOffline
+		}
+		btn := lp.levelBtns[level]
+		buttons = append(buttons,
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				return layoutCardButton(gtx, th, btn, level.String(), fg)
+			}),
+			layout.Rigid(layout.Spacer{Width: unit.Dp(4)}.Layout),
+		)
+	}
+	buttons = append(buttons,
+		layout.Flexed(1, layout.Spacer{}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutCardButton(gtx, th, &lp.pauseBtn, pauseText, colorSubtext)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(4)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutCardButton(gtx, th, &lp.exportTextBtn, "⬇ TXT", colorSubtext)
+		}),
+		layout.Rigid(layout.Spacer{Width: unit.Dp(4)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layoutCardButton(gtx, th, &lp.exportJSONBtn, "⬇ JSON", colorSubtext)
+		}),
+	)
+
+	inputs := []layout.FlexChild{
+		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+			return layoutFilterInput(gtx, th, &lp.search, "🔍 Search")
+		}),
+	}
+	if lp.Stream == "" {
+		inputs = append(inputs,
+			layout.Rigid(layout.Spacer{Width: unit.Dp(6)}.Layout),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				gtx.Constraints.Max.X = gtx.Dp(unit.Dp(140))
+				gtx.Constraints.Min.X = gtx.Constraints.Max.X
+				return layoutFilterInput(gtx, th, &lp.streamInput, "Stream key")
+			}),
+		)
+	}
+
+	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx, buttons...)
+		}),
+		layout.Rigid(layout.Spacer{Height: unit.Dp(6)}.Layout),
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Horizontal}.Layout(gtx, inputs...)
+		}),
+		// Export result
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			if lp.notice == "" || time.Since(lp.noticeAt) > noticeDuration*2 {
+				return layout.Dimensions{}
+			}
+			return layout.Inset{Top: unit.Dp(4)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				label := material.Caption(th, lp.notice)
+				label.Color = colorSubtext
+				return label.Layout(gtx)
+			})
+		}),
+	)
+}
+
+// layoutFilterInput draws a single-line text input with a hint
+func layoutFilterInput(gtx layout.Context, th *material.Theme, editor *widget.Editor, hint string) layout.Dimensions {
+	return layout.Stack{}.Layout(gtx,
+		layout.Expanded(func(gtx layout.Context) layout.Dimensions {
+			rr := gtx.Dp(unit.Dp(6))
+			paint.FillShape(gtx.Ops, colorButton, clip.UniformRRect(image.Rectangle{Max: gtx.Constraints.Min}, rr).Op(gtx.Ops))
+			return layout.Dimensions{Size: gtx.Constraints.Min}
+		}),
+		layout.Stacked(func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min.X = gtx.Constraints.Max.X
+			return layout.Inset{Top: unit.Dp(5), Bottom: unit.Dp(5), Left: unit.Dp(8), Right: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				ed := material.Editor(th, editor, hint)
+				ed.TextSize = unit.Sp(12)
+				ed.Color = colorText
+				ed.HintColor = colorOffline
+				return ed.Layout(gtx)
+			})
+		}),
+	)
+}
+
+// levelColor returns the color a level is shown in
+func levelColor(level logger.LogLevel) color.NRGBA {
+	switch level {
+	case logger.LevelDebug:
+		return colorDebug
+	case logger.LevelWarn:
+		return colorWarn
+	case logger.LevelError:
+		return colorError
+	default:
+		return colorInfo
+	}
+}
+
 func (lp *LogPanel) layoutEntry(gtx layout.Context, th *material.Theme, entry logger.Entry) layout.Dimensions {
 	return layout.Inset{Bottom: unit.Dp(2)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 		return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceEnd}.Layout(gtx,
@@ -90,21 +314,13 @@ func (lp *LogPanel) layoutEntry(gtx layout.Context, th *material.Theme, entry lo
 				label := material.Body2(th, levelStr)
 				label.Font.Weight = font.Bold
 				label.TextSize = unit.Sp(12)
-
-				switch entry.Level {
-				case logger.LevelWarn:
-					label.Color = colorWarn
-				case logger.LevelError:
-					label.Color = colorError
-				default:
-					label.Color = colorInfo
-				}
+				label.Color = levelColor(entry.Level)
 
 				return layout.Inset{Right: unit.Dp(8)}.Layout(gtx, label.Layout)
 			}),
 			// Message
 			layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
-				label := material.Body2(th, entry.Message)
+				label := material.Body2(th, entry.Text())
 				label.Color = color.NRGBA{R: 220, G: 220, B: 220, A: 255}
 				label.TextSize = unit.Sp(12)
 				label.MaxLines = 2
@@ -114,9 +330,83 @@ func (lp *LogPanel) layoutEntry(gtx layout.Context, th *material.Theme, entry lo
 	})
 }
 
+// entries returns the log entries that pass the filters
+func (lp *LogPanel) entries() []logger.Entry {
+	entries := lp.log
+	if lp.paused {
+		entries = lp.frozen
+	}
+
+	search := strings.ToLower(strings.TrimSpace(lp.search.Text()))
+	stream := strings.ToLower(strings.TrimSpace(lp.streamInput.Text()))
+	hide := func(e logger.Entry) bool {
+		if lp.hidden[e.Level] {
+			return true
+		}
+		key := fmt.Sprint(e.Field(logger.KeyStream))
+		if lp.Stream != "" && key != lp.Stream {
+			return true
+		}
+		if stream != "" && (e.Field(logger.KeyStream) == nil || !strings.Contains(strings.ToLower(key), stream)) {
+			return true
+		}
+		return search != "" && !strings.Contains(strings.ToLower(e.Text()), search)
+	}
+
+	var result []logger.Entry
+	for _, e := range entries {
+		if !hide(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// filtering reports whether any filter hides entries
+func (lp *LogPanel) filtering() bool {
+	for _, hidden := range lp.hidden {
+		if hidden {
+			return true
+		}
+	}
+	return strings.TrimSpace(lp.search.Text()) != "" || strings.TrimSpace(lp.streamInput.Text()) != ""
+}
+
+// export writes the entries that pass the filters to a file in the
+// working directory, named after the current time
+func (lp *LogPanel) export(format logger.Format) {
+	ext := ".txt"
+	if format == logger.FormatJSON {
+		ext = ".json"
+	}
+	name := "logs-" + time.Now().Format("20060102-150405") + ext
+	entries := lp.entries()
+
+	err := writeLogExport(name, entries, format)
+	if err != nil {
+		lp.notice = "⚠ Export failed: " + err.Error()
+	} else {
+		path, _ := filepath.Abs(name)
+		lp.notice = fmt.Sprintf("✔ Exported %d entries to %s", len(entries), path)
+	}
+	lp.noticeAt = time.Now()
+}
+
+func writeLogExport(name string, entries []logger.Entry, format logger.Format) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = logger.WriteEntries(f, entries, format)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
 // ScrollToBottom scrolls the log list to the bottom
 func (lp *LogPanel) ScrollToBottom() {
-	entries := logger.GetLogs()
+	entries := lp.entries()
 	if len(entries) > 0 {
 		lp.list.Position.First = len(entries) - 1
 	}
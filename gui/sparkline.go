@@ -0,0 +1,71 @@
+package gui
+
+import (
+	"image"
+	"image/color"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+)
+
+// sparklineSamples is the number of history samples a sparkline spans,
+// five minutes at one sample per second
+const sparklineSamples = 300
+
+// layoutSparkline draws values as a line chart filling the available width.
+// The newest value is at the right edge; a short history leaves the left
+// side empty. The chart scales from zero to the largest value.
+func layoutSparkline(gtx layout.Context, values []float64, height unit.Dp, col color.NRGBA) layout.Dimensions {
+	size := image.Point{X: gtx.Constraints.Max.X, Y: gtx.Dp(height)}
+	if len(values) > sparklineSamples {
+		values = values[len(values)-sparklineSamples:]
+	}
+
+	// Baseline
+	paint.FillShape(gtx.Ops, colorSparkBase, clip.Rect{Min: image.Pt(0, size.Y-1), Max: size}.Op())
+
+	peak := 0.0
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	if len(values) < 2 || peak == 0 {
+		return layout.Dimensions{Size: size}
+	}
+
+	step := float32(size.X) / float32(sparklineSamples-1)
+	x0 := float32(size.X) - step*float32(len(values)-1)
+	point := func(i int) f32.Point {
+		y := float32(size.Y-1) * (1 - float32(values[i]/peak))
+		return f32.Pt(x0+step*float32(i), y)
+	}
+
+	// Area under the line
+	var area clip.Path
+	area.Begin(gtx.Ops)
+	area.MoveTo(f32.Pt(x0, float32(size.Y)))
+	for i := range values {
+		area.LineTo(point(i))
+	}
+	area.LineTo(f32.Pt(float32(size.X), float32(size.Y)))
+	area.Close()
+	fill := col
+	fill.A = 48
+	paint.FillShape(gtx.Ops, fill, clip.Outline{Path: area.End()}.Op())
+
+	// Line
+	var line clip.Path
+	line.Begin(gtx.Ops)
+	line.MoveTo(point(0))
+	for i := 1; i < len(values); i++ {
+		line.LineTo(point(i))
+	}
+	paint.FillShape(gtx.Ops, col, clip.Stroke{
+		Path:  line.End(),
+		Width: float32(gtx.Dp(unit.Dp(1.5))),
+	}.Op())
+
+	return layout.Dimensions{Size: size}
+}
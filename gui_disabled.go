@@ -0,0 +1,9 @@
+//go:build nogui
+
+package main
+
+// guiAvailable reports whether this binary was built with the Gio GUI.
+// Builds tagged nogui have no GUI dependencies and always run headless.
+const guiAvailable = false
+
+func runGUI() {}
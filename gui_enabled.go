@@ -0,0 +1,12 @@
+//go:build !nogui
+
+package main
+
+import "rtmp_server/gui"
+
+// guiAvailable reports whether this binary was built with the Gio GUI
+const guiAvailable = true
+
+func runGUI() {
+	gui.Main()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"rtmp_server/internal/config"
+	"rtmp_server/internal/logger"
+	"rtmp_server/server"
+)
+
+// runHeadless starts the streaming server without a GUI and blocks until
+// SIGINT or SIGTERM. Configuration changes are picked up from the config
+// file or on SIGHUP. It returns the process exit code.
+func runHeadless() int {
+	logger.SetOutput(os.Stderr)
+	defer logger.CloseFile()
+
+	// Fail fast on configuration errors instead of at first use
+	cfg, err := config.ReadValid()
+	if err != nil {
+		server.LogConfigErrors("Invalid configuration in "+config.GetConfigPath(), err)
+		return 2
+	}
+
+	// Creating the service applies the log level and format
+	svc := server.NewService(cfg)
+	if name := config.Profile(); name != "" {
+		logger.Info("Loaded configuration profile %s from %s", name, config.GetConfigPath())
+	} else {
+		logger.Info("Loaded configuration from %s", config.GetConfigPath())
+	}
+
+	if err := svc.Start(); err != nil {
+		logger.Error("Failed to start server: %v", err)
+		return 1
+	}
+
+	stopWatch := svc.WatchConfig()
+	defer stopWatch()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigCh
+	logger.Info("Received %s, shutting down (send again to exit immediately)", sig)
+
+	go func() {
+		<-sigCh
+		logger.Warn("Received second signal, exiting without draining")
+		os.Exit(1)
+	}()
+
+	if err := svc.Stop(); err != nil {
+		return 1
+	}
+	return 0
+}
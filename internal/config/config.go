@@ -1,9 +1,11 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
-	"path/filepath"
 )
 
 // Config holds application configuration
@@ -11,11 +13,82 @@ type Config struct {
 	HTTPPort string `json:"http_port"`
 	RTMPPort string `json:"rtmp_port"`
 
+	// Listen addresses (host:port, [::1]:port for IPv6). They override the
+	// ports above; IPv4 and IPv6 literals bind that family only, an empty
+	// host binds both.
+	HTTPListen []string `json:"http_listen"` // HLS
+	RTMPListen []string `json:"rtmp_listen"`
+	APIListen  []string `json:"api_listen"` // Admin API; empty serves it with HLS
+
 	// SSL/TLS settings
 	SSLEnabled bool   `json:"ssl_enabled"`
 	SSLDomain  string `json:"ssl_domain"`
 	SSLCert    string `json:"ssl_cert"` // Path to certificate file
 	SSLKey     string `json:"ssl_key"`  // Path to private key file
+
+	// ACME (Let's Encrypt): obtain and renew the certificate for SSLDomain
+	// automatically instead of loading SSLCert/SSLKey
+	ACMEEnabled      bool   `json:"acme_enabled"`
+	ACMEEmail        string `json:"acme_email"`         // Contact address for expiry notices
+	ACMEDirectoryURL string `json:"acme_directory_url"` // CA directory, e.g. a local Pebble instance for testing
+	ACMECACert       string `json:"acme_ca_cert"`       // Extra CA certificate (PEM) trusted for the directory
+	ACMECacheDir     string `json:"acme_cache_dir"`     // Where account keys and certificates are stored
+	ACMEHTTPPort     string `json:"acme_http_port"`     // Port for HTTP-01 challenges; empty uses TLS-ALPN-01 only
+
+	// Playback access control
+	AllowedOrigins    []string            `json:"allowed_origins"`     // Browser origins allowed to play; empty allows any
+	AppAllowedOrigins map[string][]string `json:"app_allowed_origins"` // Per-application overrides keyed by RTMP app name
+	RefererCheck      bool                `json:"referer_check"`       // Also reject requests whose Referer is not allowed
+
+	// IP access rules (CIDR prefixes or single addresses).
+	// Deny rules win; an empty allow list permits any address.
+	PublishAllow  []string `json:"publish_allow"`
+	PublishDeny   []string `json:"publish_deny"`
+	PlaybackAllow []string `json:"playback_allow"`
+	PlaybackDeny  []string `json:"playback_deny"`
+
+	// Connection limits (0 = unlimited)
+	MaxPublishers       int `json:"max_publishers"`
+	MaxConnsPerIP       int `json:"max_conns_per_ip"` // RTMP connections per client IP
+	MaxViewersPerStream int `json:"max_viewers_per_stream"`
+	MaxViewers          int `json:"max_viewers"` // HLS viewers across all streams
+
+	// HTTP caching (Cache-Control max-age in seconds)
+	PlaylistMaxAge int `json:"playlist_max_age"`
+	SegmentMaxAge  int `json:"segment_max_age"`
+
+	// HLS segmenting, applied to streams that start after a change
+	SegmentDuration int `json:"segment_duration"` // Target segment length in seconds
+	SegmentCount    int `json:"segment_count"`    // Segments kept in the live playlist
+
+	// Seconds to wait for viewers and publishers to finish on shutdown
+	ShutdownTimeout int `json:"shutdown_timeout"`
+
+	// Stream watchdog: alert when a connected encoder stops sending data,
+	// loses its audio or video, or stays below the bitrate floor
+	StallTimeout int    `json:"stall_timeout"` // Seconds without data before alerting
+	MinBitrate   int    `json:"min_bitrate"`   // Kbps; 0 disables the bitrate floor
+	AlertWebhook string `json:"alert_webhook"` // URL alerts are POSTed to as JSON; empty disables
+
+	// Relays: rtmp:// or rtmps:// URLs each stream is re-published to,
+	// keyed by stream key
+	Relays map[string][]string `json:"relays"`
+
+	// Logging
+	LogLevel  string `json:"log_level"`  // debug, info, warn or error
+	LogFormat string `json:"log_format"` // text or json, for headless output and the log file
+
+	// Flood suppression: identical messages beyond the burst within the
+	// window are summarized as "message (repeated N times)"
+	LogFloodWindow int `json:"log_flood_window"` // Seconds
+	LogFloodBurst  int `json:"log_flood_burst"`  // Identical messages logged per window
+
+	// Log file, written alongside the in-memory log; empty disables it
+	LogFile     string `json:"log_file"`
+	LogMaxSize  int    `json:"log_max_size"`  // Megabytes before the file is rotated
+	LogMaxAge   int    `json:"log_max_age"`   // Hours before the file is rotated; 0 rotates by size only
+	LogMaxFiles int    `json:"log_max_files"` // Rotated files kept
+	LogCompress bool   `json:"log_compress"`  // gzip rotated files
 }
 
 // Default configuration
@@ -26,29 +99,65 @@ var defaultConfig = Config{
 	SSLDomain:  "",
 	SSLCert:    "cert.pem",
 	SSLKey:     "key.pem",
+
+	ACMEDirectoryURL: "https://acme-v02.api.letsencrypt.org/directory",
+	ACMECacheDir:     "acme-cache",
+
+	PlaylistMaxAge: 1,
+	SegmentMaxAge:  86400,
+
+	SegmentDuration: 2,
+	SegmentCount:    5,
+
+	ShutdownTimeout: 10,
+
+	StallTimeout: 10,
+
+	LogLevel:  "info",
+	LogFormat: "text",
+
+	LogFloodWindow: 10,
+	LogFloodBurst:  5,
+
+	LogMaxSize:  10,
+	LogMaxFiles: 5,
+}
+
+// Default returns the default configuration
+func Default() Config {
+	return defaultConfig
 }
 
-// GetConfigPath returns the path to the config file
+// GetConfigPath returns the path to the config file of the active profile
 func GetConfigPath() string {
-	exe, _ := os.Executable()
-	return filepath.Join(filepath.Dir(exe), "config.json")
+	pathMu.RLock()
+	defer pathMu.RUnlock()
+	return profilePath(basePath(), profile)
 }
 
-// Load loads configuration from file
-func Load() Config {
+// Read loads configuration from file and applies environment overrides.
+// A missing file yields the defaults, unless a named profile was selected;
+// a malformed file yields the defaults and an error describing the problem.
+// Read does not validate values, see Validate.
+func Read() (Config, error) {
 	path := GetConfigPath()
 
-	data, err := os.ReadFile(path)
+	cfg, err := readFile(path)
 	if err != nil {
-		return defaultConfig
+		return defaultConfig, err
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return defaultConfig
+	// Environment variables override the file
+	if err := applyEnv(&cfg); err != nil {
+		return defaultConfig, err
 	}
 
-	// Validate and use defaults for empty values
+	// Blank listen addresses fall back to the ports
+	cfg.HTTPListen = trimAddrs(cfg.HTTPListen)
+	cfg.RTMPListen = trimAddrs(cfg.RTMPListen)
+	cfg.APIListen = trimAddrs(cfg.APIListen)
+
+	// Use defaults for empty values
 	if cfg.HTTPPort == "" {
 		cfg.HTTPPort = defaultConfig.HTTPPort
 	}
@@ -61,12 +170,100 @@ func Load() Config {
 	if cfg.SSLKey == "" {
 		cfg.SSLKey = defaultConfig.SSLKey
 	}
+	if cfg.ACMEDirectoryURL == "" {
+		cfg.ACMEDirectoryURL = defaultConfig.ACMEDirectoryURL
+	}
+	if cfg.ACMECacheDir == "" {
+		cfg.ACMECacheDir = defaultConfig.ACMECacheDir
+	}
+	if cfg.PlaylistMaxAge == 0 {
+		cfg.PlaylistMaxAge = defaultConfig.PlaylistMaxAge
+	}
+	if cfg.SegmentMaxAge == 0 {
+		cfg.SegmentMaxAge = defaultConfig.SegmentMaxAge
+	}
+	if cfg.SegmentDuration == 0 {
+		cfg.SegmentDuration = defaultConfig.SegmentDuration
+	}
+	if cfg.SegmentCount == 0 {
+		cfg.SegmentCount = defaultConfig.SegmentCount
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = defaultConfig.ShutdownTimeout
+	}
+	if cfg.StallTimeout == 0 {
+		cfg.StallTimeout = defaultConfig.StallTimeout
+	}
+	if cfg.LogLevel == "" {
+		cfg.LogLevel = defaultConfig.LogLevel
+	}
+	if cfg.LogFormat == "" {
+		cfg.LogFormat = defaultConfig.LogFormat
+	}
+	if cfg.LogFloodWindow == 0 {
+		cfg.LogFloodWindow = defaultConfig.LogFloodWindow
+	}
+	if cfg.LogFloodBurst == 0 {
+		cfg.LogFloodBurst = defaultConfig.LogFloodBurst
+	}
+	if cfg.LogMaxSize == 0 {
+		cfg.LogMaxSize = defaultConfig.LogMaxSize
+	}
+	if cfg.LogMaxFiles == 0 {
+		cfg.LogMaxFiles = defaultConfig.LogMaxFiles
+	}
 
-	return cfg
+	return cfg, nil
 }
 
-// Save saves configuration to file
+// readFile reads and decodes the config file at path without defaults or
+// environment overrides
+func readFile(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if name := Profile(); name != "" {
+				return Config{}, FieldError{Message: fmt.Sprintf("profile %q not found: %s does not exist", name, path)}
+			}
+			return defaultConfig, nil
+		}
+		return Config{}, FieldError{Message: fmt.Sprintf("cannot read %s: %v", path, err)}
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, decodeError(path, data, err)
+	}
+	return cfg, nil
+}
+
+// decodeError turns a JSON decoding error into a FieldError that points at
+// the offending field or line
+func decodeError(path string, data []byte, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return FieldError{
+			Field:   typeErr.Field,
+			Message: fmt.Sprintf("expected %s, got JSON %s", typeErr.Type, typeErr.Value),
+		}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line := 1 + bytes.Count(data[:syntaxErr.Offset], []byte("\n"))
+		return FieldError{Message: fmt.Sprintf("%s line %d: %v", path, line, err)}
+	}
+
+	return FieldError{Message: fmt.Sprintf("%s: %v", path, err)}
+}
+
+// Save saves configuration to file. Fields overridden by environment
+// variables keep the value they have in the file.
 func Save(cfg Config) error {
+	if file, err := readFile(GetConfigPath()); err == nil {
+		restoreEnvFields(&cfg, file)
+	}
+
 	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		return err
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix prefixes environment variables that override config fields.
+// The rest of the name is the field's JSON name in upper case, so
+// GOSTREAM_HTTP_PORT overrides http_port.
+const EnvPrefix = "GOSTREAM_"
+
+// EnvName returns the environment variable that overrides a JSON field
+func EnvName(field string) string {
+	return EnvPrefix + strings.ToUpper(field)
+}
+
+// applyEnv overrides fields of cfg with values from the environment.
+// Lists are comma-separated; maps and lists may also be given as JSON.
+func applyEnv(cfg *Config) error {
+	var errs ValidationErrors
+
+	v := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := jsonName(v.Type().Field(i))
+		raw, ok := os.LookupEnv(EnvName(field))
+		if field == "" || !ok {
+			continue
+		}
+		if err := setFromEnv(v.Field(i), raw); err != nil {
+			errs = append(errs, FieldError{
+				Field:   field,
+				Message: fmt.Sprintf("invalid %s=%q: %v", EnvName(field), raw, err),
+			})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// restoreEnvFields copies fields that are overridden by the environment
+// from file into cfg, so that saving does not persist the overrides
+func restoreEnvFields(cfg *Config, file Config) {
+	v := reflect.ValueOf(cfg).Elem()
+	fv := reflect.ValueOf(file)
+	for i := 0; i < v.NumField(); i++ {
+		field := jsonName(v.Type().Field(i))
+		if _, ok := os.LookupEnv(EnvName(field)); field != "" && ok {
+			v.Field(i).Set(fv.Field(i))
+		}
+	}
+}
+
+// jsonName returns the JSON name of a struct field
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// setFromEnv parses raw into field according to its kind
+func setFromEnv(field reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("expected true or false")
+		}
+		field.SetBool(b)
+
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer")
+		}
+		field.SetInt(n)
+
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number")
+		}
+		field.SetFloat(f)
+
+	case reflect.Slice:
+		if strings.HasPrefix(raw, "[") {
+			return json.Unmarshal([]byte(raw), field.Addr().Interface())
+		}
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("expected a JSON array")
+		}
+		list := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = reflect.Append(list, reflect.ValueOf(item))
+			}
+		}
+		field.Set(list)
+
+	default:
+		// Maps and nested structures are given as JSON
+		ptr := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(raw), ptr.Interface()); err != nil {
+			return fmt.Errorf("expected JSON: %v", err)
+		}
+		field.Set(ptr.Elem())
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// HTTPAddrs returns the addresses HLS is served on: http_listen, or all
+// IPv4 interfaces on http_port if it lists no address. It is never empty.
+func (c Config) HTTPAddrs() []string {
+	if addrs := trimAddrs(c.HTTPListen); len(addrs) > 0 {
+		return addrs
+	}
+	return []string{"0.0.0.0:" + c.HTTPPort}
+}
+
+// RTMPAddrs returns the addresses RTMP is accepted on: rtmp_listen, or all
+// interfaces on rtmp_port if it lists no address. It is never empty.
+func (c Config) RTMPAddrs() []string {
+	if addrs := trimAddrs(c.RTMPListen); len(addrs) > 0 {
+		return addrs
+	}
+	return []string{":" + c.RTMPPort}
+}
+
+// APIAddrs returns the addresses the admin API is served on. Empty means
+// the API is served together with HLS.
+func (c Config) APIAddrs() []string {
+	return trimAddrs(c.APIListen)
+}
+
+// trimAddrs trims the addresses and leaves out blank ones
+func trimAddrs(addrs []string) []string {
+	result := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			result = append(result, addr)
+		}
+	}
+	return result
+}
+
+// validateListen checks that every address is host:port with a valid port
+// and returns the addresses that are valid
+func validateListen(field string, addrs []string, add addFunc) []string {
+	var valid []string
+	for _, addr := range trimAddrs(addrs) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			add(field, "%q is not a host:port address (use [::1]:8080 for IPv6)", addr)
+			continue
+		}
+		if strings.ContainsAny(host, "/ ") {
+			add(field, "%q has an invalid host", addr)
+			continue
+		}
+		if n := portNumber(port); n < 1 || n > 65535 {
+			add(field, "%q has an invalid port", addr)
+			continue
+		}
+		valid = append(valid, addr)
+	}
+	return valid
+}
+
+// listenConflict reports whether two listen addresses would compete for
+// the same port
+func listenConflict(a, b string) bool {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil || portNumber(portA) != portNumber(portB) {
+		return false
+	}
+	return hostA == hostB || isWildcardHost(hostA) || isWildcardHost(hostB)
+}
+
+// isWildcardHost reports whether host binds all interfaces
+func isWildcardHost(host string) bool {
+	if host == "" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsUnspecified()
+}
@@ -0,0 +1,25 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBlankListenFallsBackToPorts(t *testing.T) {
+	cfg := Default()
+	cfg.HTTPListen = []string{""}
+	cfg.RTMPListen = []string{" ", "\t"}
+
+	if got := cfg.HTTPAddrs(); !slices.Equal(got, []string{"0.0.0.0:" + cfg.HTTPPort}) {
+		t.Errorf("HTTPAddrs() = %q", got)
+	}
+	if got := cfg.RTMPAddrs(); !slices.Equal(got, []string{":" + cfg.RTMPPort}) {
+		t.Errorf("RTMPAddrs() = %q", got)
+	}
+
+	// The ports are still checked against each other
+	cfg.RTMPPort = cfg.HTTPPort
+	if err := Validate(cfg); AsValidationErrors(err).Field("http_port") == nil {
+		t.Errorf("Validate() = %v, want an http_port conflict", err)
+	}
+}
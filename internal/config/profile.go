@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	pathMu   sync.RWMutex
+	pathFlag string // Set by SetPath, e.g. from --config
+	profile  string // Active profile name, empty for the default profile
+)
+
+// SetPath sets the config file of the default profile. An empty path
+// restores the default, config.json next to the executable.
+func SetPath(path string) {
+	pathMu.Lock()
+	defer pathMu.Unlock()
+	pathFlag = path
+}
+
+// SetProfile selects a named profile. Profile "staging" is stored in
+// config.staging.json next to the default config file; an empty name
+// selects the default profile.
+func SetProfile(name string) {
+	pathMu.Lock()
+	defer pathMu.Unlock()
+	profile = name
+}
+
+// Profile returns the active profile name, empty for the default profile
+func Profile() string {
+	pathMu.RLock()
+	defer pathMu.RUnlock()
+	return profile
+}
+
+// Profiles lists the named profiles found next to the default config file
+func Profiles() []string {
+	pathMu.RLock()
+	base := basePath()
+	pathMu.RUnlock()
+
+	stem, ext := splitExt(base)
+	matches, _ := filepath.Glob(stem + ".*" + ext)
+
+	names := make([]string, 0, len(matches))
+	for _, m := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(m, stem+"."), ext)
+		if name != "" && !strings.Contains(name, ".") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// basePath returns the default profile's config path; the caller must hold pathMu
+func basePath() string {
+	if pathFlag != "" {
+		return pathFlag
+	}
+	exe, _ := os.Executable()
+	return filepath.Join(filepath.Dir(exe), "config.json")
+}
+
+// profilePath returns the config path of the named profile
+func profilePath(base, name string) string {
+	if name == "" {
+		return base
+	}
+	stem, ext := splitExt(base)
+	return stem + "." + name + ext
+}
+
+// splitExt splits "dir/config.json" into "dir/config" and ".json"
+func splitExt(path string) (string, string) {
+	ext := filepath.Ext(path)
+	if ext == "" {
+		ext = ".json"
+		return path, ext
+	}
+	return strings.TrimSuffix(path, ext), ext
+}
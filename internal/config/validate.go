@@ -0,0 +1,336 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FieldError describes a problem with one configuration field
+type FieldError struct {
+	Field   string // JSON name of the field, e.g. "http_port"; empty for the whole file
+	Message string
+}
+
+func (e FieldError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors lists every invalid field of a configuration
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, e := range v {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Field returns the error for the named field, or nil if it is valid
+func (v ValidationErrors) Field(name string) *FieldError {
+	for i := range v {
+		if v[i].Field == name {
+			return &v[i]
+		}
+	}
+	return nil
+}
+
+// AsValidationErrors extracts field errors from err, wrapping any other
+// error as a file-level FieldError
+func AsValidationErrors(err error) ValidationErrors {
+	if err == nil {
+		return nil
+	}
+	var v ValidationErrors
+	if errors.As(err, &v) {
+		return v
+	}
+	var fe FieldError
+	if errors.As(err, &fe) {
+		return ValidationErrors{fe}
+	}
+	return ValidationErrors{{Message: err.Error()}}
+}
+
+// addFunc records a problem with a field
+type addFunc func(field, format string, args ...interface{})
+
+// ReadValid reads the config file and validates it
+func ReadValid() (Config, error) {
+	cfg, err := Read()
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, Validate(cfg)
+}
+
+// Validate checks cfg for problems that would otherwise only surface when
+// the servers start. It returns ValidationErrors or nil.
+func Validate(cfg Config) error {
+	var errs ValidationErrors
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Ports and listen addresses
+	httpOK := validatePort(cfg.HTTPPort, "http_port", add)
+	rtmpOK := validatePort(cfg.RTMPPort, "rtmp_port", add)
+	validateListeners(cfg, httpOK, rtmpOK, add)
+
+	// SSL
+	if cfg.SSLEnabled {
+		if !cfg.ACMEEnabled {
+			validateTLSFiles(cfg.SSLCert, cfg.SSLKey, add)
+		}
+		if d := cfg.SSLDomain; d != "" && (strings.Contains(d, "://") || strings.ContainsAny(d, "/ ")) {
+			add("ssl_domain", "must be a host name like example.com, not %q", d)
+		}
+	}
+
+	// ACME
+	if cfg.ACMEEnabled {
+		validateACME(cfg, add)
+	}
+
+	// IP access rules
+	validateCIDRs("publish_allow", cfg.PublishAllow, add)
+	validateCIDRs("publish_deny", cfg.PublishDeny, add)
+	validateCIDRs("playback_allow", cfg.PlaybackAllow, add)
+	validateCIDRs("playback_deny", cfg.PlaybackDeny, add)
+
+	// Limits and durations must not be negative
+	for _, f := range []struct {
+		name  string
+		value int
+	}{
+		{"max_publishers", cfg.MaxPublishers},
+		{"max_conns_per_ip", cfg.MaxConnsPerIP},
+		{"max_viewers_per_stream", cfg.MaxViewersPerStream},
+		{"max_viewers", cfg.MaxViewers},
+		{"playlist_max_age", cfg.PlaylistMaxAge},
+		{"segment_max_age", cfg.SegmentMaxAge},
+		{"segment_duration", cfg.SegmentDuration},
+		{"segment_count", cfg.SegmentCount},
+		{"shutdown_timeout", cfg.ShutdownTimeout},
+		{"stall_timeout", cfg.StallTimeout},
+		{"min_bitrate", cfg.MinBitrate},
+		{"log_flood_window", cfg.LogFloodWindow},
+		{"log_flood_burst", cfg.LogFloodBurst},
+		{"log_max_size", cfg.LogMaxSize},
+		{"log_max_age", cfg.LogMaxAge},
+		{"log_max_files", cfg.LogMaxFiles},
+	} {
+		if f.value < 0 {
+			add(f.name, "must not be negative (got %d)", f.value)
+		}
+	}
+
+	if cfg.AlertWebhook != "" {
+		if u, err := url.Parse(cfg.AlertWebhook); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			add("alert_webhook", "must be an http(s) URL, got %q", cfg.AlertWebhook)
+		}
+	}
+
+	for key, urls := range cfg.Relays {
+		if strings.TrimSpace(key) == "" {
+			add("relays", "stream key must not be empty")
+		}
+		for i, u := range urls {
+			if err := ValidateRelayURL(u); err != nil {
+				add("relays", "%s, target %d: %v", key, i+1, err)
+			}
+		}
+	}
+
+	// Logging
+	switch strings.ToLower(cfg.LogLevel) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		add("log_level", "must be debug, info, warn or error, not %q", cfg.LogLevel)
+	}
+	switch strings.ToLower(cfg.LogFormat) {
+	case "", "text", "json":
+	default:
+		add("log_format", "must be text or json, not %q", cfg.LogFormat)
+	}
+	if cfg.LogFile != "" {
+		if info, err := os.Stat(filepath.Dir(cfg.LogFile)); err != nil || !info.IsDir() {
+			add("log_file", "directory of %s does not exist", cfg.LogFile)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// ValidateRelayURL checks that s is an rtmp:// or rtmps:// URL with a host
+// and a stream path, as relays publish to. Errors leave out the URL, which
+// usually contains a secret stream key.
+func ValidateRelayURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "rtmp" && u.Scheme != "rtmps") || u.Host == "" {
+		return errors.New("must be an rtmp:// or rtmps:// URL")
+	}
+	if strings.Trim(u.Path, "/") == "" {
+		return errors.New("URL has no application or stream key")
+	}
+	return nil
+}
+
+// validateListeners checks the listen address lists and that no two
+// servers compete for the same address. Ports are only compared when the
+// lists don't override them.
+func validateListeners(cfg Config, httpOK, rtmpOK bool, add addFunc) {
+	lists := []struct {
+		field string
+		addrs []string
+	}{
+		{"http_listen", validateListen("http_listen", cfg.HTTPListen, add)},
+		{"rtmp_listen", validateListen("rtmp_listen", cfg.RTMPListen, add)},
+		{"api_listen", validateListen("api_listen", cfg.APIListen, add)},
+	}
+	httpListen, rtmpListen := trimAddrs(cfg.HTTPListen), trimAddrs(cfg.RTMPListen)
+	if len(httpListen) == 0 && len(rtmpListen) == 0 && httpOK && rtmpOK &&
+		portNumber(cfg.HTTPPort) == portNumber(cfg.RTMPPort) {
+		add("http_port", "must differ from rtmp_port (%s)", cfg.RTMPPort)
+		return
+	}
+	if len(httpListen) == 0 {
+		if !httpOK {
+			return
+		}
+		lists[0].field, lists[0].addrs = "http_port", cfg.HTTPAddrs()
+	}
+	if len(rtmpListen) == 0 {
+		if !rtmpOK {
+			return
+		}
+		lists[1].field, lists[1].addrs = "rtmp_port", cfg.RTMPAddrs()
+	}
+
+	for i := range lists {
+		for j := i + 1; j < len(lists); j++ {
+			for _, a := range lists[i].addrs {
+				for _, b := range lists[j].addrs {
+					if listenConflict(a, b) {
+						add(lists[j].field, "%s conflicts with %s in %s", b, a, lists[i].field)
+					}
+				}
+			}
+		}
+	}
+}
+
+// validatePort reports whether port is a number between 1 and 65535
+func validatePort(port, field string, add addFunc) bool {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		add(field, "must be a number, got %q", port)
+		return false
+	}
+	if n < 1 || n > 65535 {
+		add(field, "must be between 1 and 65535, got %d", n)
+		return false
+	}
+	return true
+}
+
+func portNumber(port string) int {
+	n, _ := strconv.Atoi(port)
+	return n
+}
+
+// validateTLSFiles checks that the certificate and key exist and form a pair
+func validateTLSFiles(certFile, keyFile string, add addFunc) {
+	certOK := fileReadable(certFile, "ssl_cert", add)
+	keyOK := fileReadable(keyFile, "ssl_key", add)
+	if !certOK || !keyOK {
+		return
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		add("ssl_cert", "cannot load certificate/key pair: %v", err)
+	}
+}
+
+func fileReadable(path, field string, add addFunc) bool {
+	if path == "" {
+		add(field, "is required when SSL is enabled")
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			add(field, "file %s does not exist", path)
+		} else {
+			add(field, "cannot access %s: %v", path, err)
+		}
+		return false
+	}
+	if info.IsDir() {
+		add(field, "%s is a directory, not a file", path)
+		return false
+	}
+	return true
+}
+
+// validateACME checks the settings needed to obtain certificates from an
+// ACME CA
+func validateACME(cfg Config, add addFunc) {
+	if !cfg.SSLEnabled {
+		add("acme_enabled", "requires ssl_enabled")
+	}
+	if cfg.SSLDomain == "" {
+		add("ssl_domain", "is required when ACME is enabled")
+	} else if !strings.Contains(strings.Trim(cfg.SSLDomain, "."), ".") {
+		add("ssl_domain", "must be a fully qualified domain name for ACME, got %q", cfg.SSLDomain)
+	}
+
+	if u, err := url.Parse(cfg.ACMEDirectoryURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		add("acme_directory_url", "must be an http(s) URL, got %q", cfg.ACMEDirectoryURL)
+	}
+	if cfg.ACMECACert != "" {
+		fileReadable(cfg.ACMECACert, "acme_ca_cert", add)
+	}
+	if cfg.ACMEEmail != "" && !strings.Contains(cfg.ACMEEmail, "@") {
+		add("acme_email", "must be an email address, got %q", cfg.ACMEEmail)
+	}
+
+	if cfg.ACMEHTTPPort != "" && validatePort(cfg.ACMEHTTPPort, "acme_http_port", add) {
+		acmeAddr := ":" + cfg.ACMEHTTPPort
+		for _, addr := range append(append(cfg.HTTPAddrs(), cfg.RTMPAddrs()...), cfg.APIAddrs()...) {
+			if listenConflict(acmeAddr, addr) {
+				add("acme_http_port", "conflicts with listen address %s", addr)
+				break
+			}
+		}
+	}
+}
+
+// validateCIDRs checks that every rule is a CIDR prefix or single address
+func validateCIDRs(field string, rules []string, add addFunc) {
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		var err error
+		if strings.Contains(rule, "/") {
+			_, err = netip.ParsePrefix(rule)
+		} else {
+			_, err = netip.ParseAddr(rule)
+		}
+		if err != nil {
+			add(field, "%q is not a valid IP address or CIDR prefix", rule)
+		}
+	}
+}
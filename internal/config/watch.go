@@ -0,0 +1,50 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// Watch polls the config file every interval and calls onChange whenever
+// the file's modification time or size changes. onChange receives the
+// reloaded configuration, or an error if it cannot be read or is invalid.
+// It returns a function that stops watching.
+func Watch(interval time.Duration, onChange func(Config, error)) (stop func()) {
+	done := make(chan struct{})
+	last := fileStamp(GetConfigPath())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				stamp := fileStamp(GetConfigPath())
+				if stamp == last {
+					continue
+				}
+				last = stamp
+				onChange(ReadValid())
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// stamp identifies a version of a file on disk
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func fileStamp(path string) stamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{modTime: info.ModTime(), size: info.Size()}
+}
@@ -2,21 +2,27 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // LogLevel represents the severity of a log entry
 type LogLevel int
 
+// LevelInfo stays the zero value, so a zero Buffer records Info and above
 const (
-	LevelInfo LogLevel = iota
+	LevelDebug LogLevel = iota - 1
+	LevelInfo
 	LevelWarn
 	LevelError
 )
 
 func (l LogLevel) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelWarn:
 		return "WARN"
 	case LevelError:
@@ -26,11 +32,34 @@ func (l LogLevel) String() string {
 	}
 }
 
+// MaxEntries is the number of entries the global buffer keeps
+const MaxEntries = 500
+
 // Entry represents a single log entry
 type Entry struct {
+	Seq     uint64 // Position in the log, counting from 1
 	Time    time.Time
 	Level   LogLevel
 	Message string
+	Fields  []Field // Context such as the stream key, in the order added
+}
+
+// Text returns the message followed by the fields as key=value pairs
+func (e Entry) Text() string {
+	if len(e.Fields) == 0 {
+		return e.Message
+	}
+	return string(appendTextFields([]byte(e.Message), e.Fields))
+}
+
+// Field returns the value of the field with key, or nil if there is none
+func (e Entry) Field(key string) any {
+	for _, f := range e.Fields {
+		if f.Key == key {
+			return f.Value
+		}
+	}
+	return nil
 }
 
 // Buffer is a thread-safe circular log buffer
@@ -38,32 +67,100 @@ type Buffer struct {
 	mu      sync.Mutex
 	entries []Entry
 	maxSize int
+	seq     uint64          // Seq of the last entry added
+	subs    []*Subscription // Receivers of new entries, e.g. the log file
+	out     io.Writer       // Optional mirror of every entry, e.g. stderr
+	format  atomic.Int64    // Line Format of out and the log file
+
+	level atomic.Int64 // Minimum LogLevel recorded
+	flood *floodFilter // Suppresses repeated messages; nil disables
 }
 
 // Global buffer instance
 var (
-	globalBuffer = &Buffer{
-		entries: make([]Entry, 0, 500),
-		maxSize: 500,
-	}
+	globalBuffer = newGlobalBuffer()
 )
 
+func newGlobalBuffer() *Buffer {
+	b := &Buffer{
+		entries: make([]Entry, 0, MaxEntries),
+		maxSize: MaxEntries,
+	}
+	b.flood = newFloodFilter(b)
+	return b
+}
+
 // Add adds a new log entry to the buffer
 func (b *Buffer) Add(level LogLevel, format string, args ...interface{}) {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+	b.log(level, nil, "", format, args)
+}
+
+// log records a formatted entry unless its level is disabled or the
+// message is flooding. fieldsKey identifies fields for flood suppression.
+func (b *Buffer) log(level LogLevel, fields []Field, fieldsKey, format string, args []any) {
+	if !b.Enabled(level) {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	key := floodKey{level: level, message: message, fields: fieldsKey}
+	if !b.flood.allow(key) {
+		return
+	}
 
 	entry := Entry{
 		Time:    time.Now(),
 		Level:   level,
-		Message: fmt.Sprintf(format, args...),
+		Message: message,
+		Fields:  fields,
 	}
+	b.add(entry)
+	b.flood.logged(key, entry)
+}
 
+func (b *Buffer) add(entry Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	entry.Seq = b.seq
 	if len(b.entries) >= b.maxSize {
 		// Remove oldest entry
 		b.entries = b.entries[1:]
 	}
 	b.entries = append(b.entries, entry)
+	b.publish(entry)
+
+	if b.out != nil {
+		b.out.Write(formatLine(entry, b.lineFormat()))
+	}
+}
+
+// Enabled reports whether entries of level are recorded
+func (b *Buffer) Enabled(level LogLevel) bool {
+	return level >= LogLevel(b.level.Load())
+}
+
+// SetLevel sets the minimum level recorded
+func (b *Buffer) SetLevel(level LogLevel) {
+	b.level.Store(int64(level))
+}
+
+// SetOutput mirrors every new entry to w as a line. Pass nil to stop.
+func (b *Buffer) SetOutput(w io.Writer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.out = w
+}
+
+// SetFormat selects the line format of the outputs
+func (b *Buffer) SetFormat(f Format) {
+	b.format.Store(int64(f))
+}
+
+// lineFormat returns the format set with SetFormat. It does not take
+// b.mu, so that the log file can be written while entries are added.
+func (b *Buffer) lineFormat() Format {
+	return Format(b.format.Load())
 }
 
 // GetEntries returns a copy of all log entries
@@ -84,6 +181,10 @@ func (b *Buffer) Clear() {
 }
 
 // Global convenience functions
+func Debug(format string, args ...interface{}) {
+	globalBuffer.Add(LevelDebug, format, args...)
+}
+
 func Info(format string, args ...interface{}) {
 	globalBuffer.Add(LevelInfo, format, args...)
 }
@@ -103,3 +204,24 @@ func GetLogs() []Entry {
 func ClearLogs() {
 	globalBuffer.Clear()
 }
+
+// SetOutput mirrors all log entries to w, used by headless mode
+func SetOutput(w io.Writer) {
+	globalBuffer.SetOutput(w)
+}
+
+// SetFormat selects text or JSON lines for stderr and the log file
+func SetFormat(f Format) {
+	globalBuffer.SetFormat(f)
+}
+
+// SetLevel sets the minimum level that is logged
+func SetLevel(level LogLevel) {
+	globalBuffer.SetLevel(level)
+}
+
+// SetFloodLimits logs at most burst identical messages per window; the
+// rest are summarized as "message (repeated N times)" when the window ends
+func SetFloodLimits(window time.Duration, burst int) {
+	globalBuffer.flood.setLimits(window, burst)
+}
@@ -0,0 +1,309 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileOptions configures the log file
+type FileOptions struct {
+	Path     string        // Empty disables the log file
+	MaxSize  int64         // Bytes before the file is rotated; 0 disables
+	MaxAge   time.Duration // Age before the file is rotated; 0 disables
+	MaxFiles int           // Rotated files kept; 0 keeps all
+	Compress bool          // gzip rotated files
+}
+
+// rotatedTimeFormat is sortable, so the oldest rotated files sort first
+const rotatedTimeFormat = "2006-01-02T15-04-05.000"
+
+// FileSink is an io.Writer that appends log lines to a file and rotates it
+// by size and age. Rotated files are named after the file with the time of
+// rotation, e.g. server-2026-01-02T15-04-05.000.log, optionally gzipped.
+type FileSink struct {
+	opts FileOptions
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+
+	millMu sync.Mutex     // Serializes compression and pruning
+	millWG sync.WaitGroup // Running mill goroutines, waited for by Close
+}
+
+// OpenFile opens the log file for appending, creating it if needed. A file
+// left over from an earlier run that is older than MaxAge is rotated first.
+func OpenFile(opts FileOptions) (*FileSink, error) {
+	s := &FileSink{opts: opts}
+
+	if info, err := os.Stat(opts.Path); err == nil && opts.MaxAge > 0 && time.Since(info.ModTime()) > opts.MaxAge {
+		if err := s.rename(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write appends one log line, rotating the file first if it is full or
+// too old
+func (s *FileSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return 0, os.ErrClosed
+	}
+	if s.needsRotation(int64(len(p))) {
+		if err := s.rotate(); err != nil {
+			// Keep logging to the current file rather than losing entries
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+		}
+	}
+
+	n, err := s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// Close closes the file and waits for rotated files to be compressed
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	var err error
+	if s.file != nil {
+		err = s.file.Close()
+		s.file = nil
+	}
+	s.mu.Unlock()
+
+	s.millWG.Wait()
+	return err
+}
+
+func (s *FileSink) needsRotation(n int64) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.opts.MaxSize > 0 && s.size+n > s.opts.MaxSize {
+		return true
+	}
+	return s.opts.MaxAge > 0 && time.Since(s.opened) > s.opts.MaxAge
+}
+
+// open opens the current file. The caller must hold s.mu or own s.
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.opts.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	s.file = f
+	s.size = info.Size()
+	s.opened = time.Now()
+	return nil
+}
+
+// rotate moves the current file aside and starts a new one. The caller
+// must hold s.mu.
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+	renameErr := s.rename()
+	if err := s.open(); err != nil {
+		return err
+	}
+	return renameErr
+}
+
+// rename moves the current file to its rotated name and starts
+// compressing and pruning rotated files in the background
+func (s *FileSink) rename() error {
+	dir, prefix, ext := s.nameParts()
+	rotated := filepath.Join(dir, prefix+time.Now().Format(rotatedTimeFormat)+ext)
+	if err := os.Rename(s.opts.Path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+
+	s.millWG.Add(1)
+	go func() {
+		defer s.millWG.Done()
+		s.mill(rotated)
+	}()
+	return nil
+}
+
+// mill compresses a rotated file and removes rotated files beyond MaxFiles
+func (s *FileSink) mill(rotated string) {
+	s.millMu.Lock()
+	defer s.millMu.Unlock()
+
+	if s.opts.Compress {
+		if err := compressFile(rotated); err != nil {
+			fmt.Fprintf(os.Stderr, "log compression failed: %v\n", err)
+		}
+	}
+
+	if s.opts.MaxFiles <= 0 {
+		return
+	}
+	files := s.rotatedFiles()
+	if len(files) <= s.opts.MaxFiles {
+		return
+	}
+	for _, name := range files[:len(files)-s.opts.MaxFiles] {
+		os.Remove(name)
+	}
+}
+
+// rotatedFiles lists rotated files, oldest first
+func (s *FileSink) rotatedFiles() []string {
+	dir, prefix, ext := s.nameParts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		stamp, ok = strings.CutSuffix(stamp, ext)
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(rotatedTimeFormat, stamp); err != nil {
+			continue
+		}
+		files = append(files, filepath.Join(dir, name))
+	}
+	// The timestamp sorts chronologically; a .gz and its source sort together
+	slices.Sort(files)
+	return files
+}
+
+// nameParts splits the path into directory, "name-" and extension, e.g.
+// "logs", "server-" and ".log" for logs/server.log
+func (s *FileSink) nameParts() (dir, prefix, ext string) {
+	dir, base := filepath.Split(s.opts.Path)
+	if dir == "" {
+		dir = "."
+	}
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext) + "-", ext
+}
+
+// compressFile gzips name to name.gz and removes name
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+
+	src.Close()
+	return os.Remove(name)
+}
+
+// fileQueue is the number of entries waiting to be written to the log
+// file before logging waits for the file
+const fileQueue = 256
+
+// The log file of the global buffer
+var (
+	fileMu   sync.Mutex
+	fileSink *FileSink
+	fileOpts FileOptions
+	fileSub  *Subscription // Entries for fileSink
+	fileDone chan struct{} // Closed once fileSub is drained
+)
+
+// SetFile starts, reconfigures or, with an empty path, stops logging to a
+// file. The file is reopened only when the options changed.
+func SetFile(opts FileOptions) error {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	if fileSink != nil && opts == fileOpts {
+		return nil
+	}
+	closeFileLocked()
+	if opts.Path == "" {
+		return nil
+	}
+
+	sink, err := OpenFile(opts)
+	if err != nil {
+		return err
+	}
+	fileSink, fileOpts = sink, opts
+	globalBuffer.mu.Lock()
+	fileSub = globalBuffer.subscribeLocked(fileQueue, true)
+	globalBuffer.mu.Unlock()
+	fileDone = make(chan struct{})
+	go writeSubscription(sink, fileSub, fileDone)
+	return nil
+}
+
+// writeSubscription writes the entries of the lossless sub to w as lines
+// until sub is closed, then closes done
+func writeSubscription(w io.Writer, sub *Subscription, done chan struct{}) {
+	defer close(done)
+	for e := range sub.C {
+		w.Write(formatLine(e, sub.b.lineFormat()))
+	}
+}
+
+// CloseFile stops logging to the file set with SetFile
+func CloseFile() {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	closeFileLocked()
+}
+
+func closeFileLocked() {
+	if fileSink == nil {
+		return
+	}
+	// Write what is queued before closing the file
+	fileSub.Close()
+	<-fileDone
+	fileSink.Close()
+	fileSink, fileOpts, fileSub, fileDone = nil, FileOptions{}, nil, nil
+}
@@ -0,0 +1,28 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileKeepsBursts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	if err := SetFile(FileOptions{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	const n = 20 * fileQueue
+	for i := range n {
+		Info("burst %d", i)
+	}
+	CloseFile()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != n {
+		t.Errorf("%d lines in the log file, want %d", lines, n)
+	}
+}
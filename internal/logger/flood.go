@@ -0,0 +1,167 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults for flood suppression, see SetFloodLimits
+const (
+	defaultFloodWindow = 10 * time.Second
+	defaultFloodBurst  = 5
+)
+
+// floodSweepSize is the number of tracked messages above which idle ones
+// are forgotten while logging, not only when a summary is due
+const floodSweepSize = 1000
+
+// floodKey identifies identical messages: the same text logged at the
+// same level with the same fields
+type floodKey struct {
+	level   LogLevel
+	message string
+	fields  string
+}
+
+// floodState counts one message within the current window
+type floodState struct {
+	start      time.Time
+	count      int   // Messages in this window, logged or not
+	suppressed int   // Messages not logged in this window
+	last       Entry // Last message logged, repeated in the summary
+}
+
+// floodFilter logs at most burst identical messages per window. Further
+// ones are counted and summarized as "message (repeated N times)" once
+// the window ends.
+type floodFilter struct {
+	buf *Buffer
+
+	mu     sync.Mutex
+	window time.Duration
+	burst  int
+	states map[floodKey]*floodState
+	timer  *time.Timer // Pending flush of summaries; nil when none are due
+}
+
+func newFloodFilter(buf *Buffer) *floodFilter {
+	return &floodFilter{
+		buf:    buf,
+		window: defaultFloodWindow,
+		burst:  defaultFloodBurst,
+		states: make(map[floodKey]*floodState),
+	}
+}
+
+// setLimits changes the window and burst for messages logged from now on
+func (f *floodFilter) setLimits(window time.Duration, burst int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.window, f.burst = window, burst
+}
+
+// allow reports whether a message with key may be logged. A nil filter
+// allows everything.
+func (f *floodFilter) allow(key floodKey) bool {
+	if f == nil {
+		return true
+	}
+	now := time.Now()
+
+	f.mu.Lock()
+	var summaries []Entry
+	st := f.states[key]
+	if st == nil || now.Sub(st.start) >= f.window {
+		if st != nil {
+			if e := st.summary(now); e != nil {
+				summaries = append(summaries, *e)
+			}
+		}
+		if len(f.states) >= floodSweepSize {
+			summaries = append(summaries, f.sweep(now)...)
+		}
+		st = &floodState{start: now}
+		f.states[key] = st
+	}
+	st.count++
+	allowed := st.count <= f.burst
+	if !allowed {
+		st.suppressed++
+		if f.timer == nil {
+			f.timer = time.AfterFunc(st.start.Add(f.window).Sub(now), f.flush)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, e := range summaries {
+		f.buf.add(e)
+	}
+	return allowed
+}
+
+// logged remembers the last entry logged for key, to repeat it in the
+// summary
+func (f *floodFilter) logged(key floodKey, entry Entry) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if st := f.states[key]; st != nil {
+		st.last = entry
+	}
+}
+
+// flush logs the summaries of windows that have ended and schedules the
+// next flush if more are pending
+func (f *floodFilter) flush() {
+	now := time.Now()
+
+	f.mu.Lock()
+	summaries := f.sweep(now)
+	f.timer = nil
+	var next time.Time
+	for _, st := range f.states {
+		if end := st.start.Add(f.window); st.suppressed > 0 && (next.IsZero() || end.Before(next)) {
+			next = end
+		}
+	}
+	if !next.IsZero() {
+		f.timer = time.AfterFunc(next.Sub(now), f.flush)
+	}
+	f.mu.Unlock()
+
+	for _, e := range summaries {
+		f.buf.add(e)
+	}
+}
+
+// sweep forgets messages whose window has ended and returns their
+// summaries. The caller must hold f.mu.
+func (f *floodFilter) sweep(now time.Time) []Entry {
+	var summaries []Entry
+	for key, st := range f.states {
+		if now.Sub(st.start) < f.window {
+			continue
+		}
+		if e := st.summary(now); e != nil {
+			summaries = append(summaries, *e)
+		}
+		delete(f.states, key)
+	}
+	return summaries
+}
+
+// summary returns the entry reporting suppressed messages, or nil if none
+// were suppressed
+func (st *floodState) summary(now time.Time) *Entry {
+	if st.suppressed == 0 {
+		return nil
+	}
+	e := st.last
+	e.Time = now
+	e.Message = fmt.Sprintf("%s (repeated %d times)", e.Message, st.suppressed)
+	st.suppressed = 0
+	return &e
+}
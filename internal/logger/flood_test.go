@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFloodKeysOnMessage(t *testing.T) {
+	b := newGlobalBuffer()
+	for i := range 2 * defaultFloodBurst {
+		b.Add(LevelWarn, "Ignoring invalid rule %d", i)
+	}
+	for range 2 * defaultFloodBurst {
+		b.Add(LevelWarn, "Ignoring invalid rule %d", 99)
+	}
+
+	entries := b.GetEntries()
+	if want := 3 * defaultFloodBurst; len(entries) != want {
+		t.Fatalf("%d entries logged, want %d", len(entries), want)
+	}
+	for _, e := range entries {
+		if strings.Contains(e.Message, "repeated") {
+			t.Errorf("distinct messages summarized: %q", e.Message)
+		}
+	}
+
+	// End the window and summarize
+	b.flood.mu.Lock()
+	for _, st := range b.flood.states {
+		st.start = st.start.Add(-2 * defaultFloodWindow)
+	}
+	b.flood.mu.Unlock()
+	b.flood.flush()
+	entries = b.GetEntries()
+	if last := entries[len(entries)-1].Message; last != "Ignoring invalid rule 99 (repeated 5 times)" {
+		t.Errorf("summary = %q", last)
+	}
+}
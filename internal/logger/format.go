@@ -0,0 +1,135 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format is the line format of log output
+type Format int
+
+const (
+	FormatText Format = iota // 2006-01-02 15:04:05 [INFO] message key=value
+	FormatJSON               // One JSON object per line, e.g. for Loki
+)
+
+// ParseLevel parses a level name as used in the config file. An empty
+// name is LevelInfo.
+func ParseLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// ParseFormat parses "text" or "json". An empty name is FormatText.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "", "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return FormatText, fmt.Errorf("unknown log format %q", name)
+}
+
+// WriteEntries writes entries to w as text lines or, with FormatJSON, as a
+// JSON array of the objects the JSON log format writes per line
+func WriteEntries(w io.Writer, entries []Entry, f Format) error {
+	var b []byte
+	if f == FormatJSON {
+		b = append(b, "[\n"...)
+	}
+	for i, e := range entries {
+		if f == FormatJSON && i > 0 {
+			// Turn the previous object's newline into a separator
+			b = append(b[:len(b)-1], ",\n"...)
+		}
+		b = append(b, formatLine(e, f)...)
+	}
+	if f == FormatJSON {
+		b = append(b, "]\n"...)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// MarshalJSON encodes e as the object the JSON log format writes per line
+func (e Entry) MarshalJSON() ([]byte, error) {
+	b := appendJSON(nil, e)
+	return b[:len(b)-1], nil
+}
+
+// formatLine renders an entry as one line, including the newline
+func formatLine(e Entry, f Format) []byte {
+	if f == FormatJSON {
+		return appendJSON(nil, e)
+	}
+	b := make([]byte, 0, 64+len(e.Message))
+	b = e.Time.AppendFormat(b, "2006-01-02 15:04:05")
+	b = append(b, " ["...)
+	b = append(b, e.Level.String()...)
+	b = append(b, "] "...)
+	b = append(b, e.Message...)
+	b = appendTextFields(b, e.Fields)
+	return append(b, '\n')
+}
+
+// appendTextFields appends " key=value" for each field, quoting values
+// that contain spaces, quotes or equals signs
+func appendTextFields(b []byte, fields []Field) []byte {
+	for _, f := range fields {
+		b = append(b, ' ')
+		b = append(b, f.Key...)
+		b = append(b, '=')
+		s := fmt.Sprint(f.Value)
+		if s == "" || strings.ContainsAny(s, " \"=\t\n") {
+			b = strconv.AppendQuote(b, s)
+		} else {
+			b = append(b, s...)
+		}
+	}
+	return b
+}
+
+// appendJSON appends e as a JSON object with the fields as top-level keys
+func appendJSON(b []byte, e Entry) []byte {
+	b = append(b, `{"time":`...)
+	b = appendJSONValue(b, e.Time.Format(time.RFC3339Nano))
+	b = append(b, `,"level":`...)
+	b = appendJSONValue(b, e.Level.String())
+	b = append(b, `,"msg":`...)
+	b = appendJSONValue(b, e.Message)
+	for _, f := range e.Fields {
+		b = append(b, ',')
+		b = appendJSONValue(b, f.Key)
+		b = append(b, ':')
+		b = appendJSONValue(b, f.Value)
+	}
+	return append(b, "}\n"...)
+}
+
+func appendJSONValue(b []byte, v any) []byte {
+	switch t := v.(type) {
+	case error:
+		v = t.Error()
+	case fmt.Stringer:
+		v = t.String()
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return append(b, data...)
+}
@@ -0,0 +1,103 @@
+package logger
+
+import (
+	"log/slog"
+	"slices"
+)
+
+// Field keys used across the server, so entries can be filtered by them
+const (
+	KeyStream = "stream" // Stream key
+	KeyRemote = "remote" // Client address
+	KeyConn   = "conn"   // RTMP connection ID
+	KeyRelay  = "relay"  // Relay target ID
+)
+
+// Field is a key/value pair attached to a log entry
+type Field struct {
+	Key   string
+	Value any
+}
+
+// Logger logs to the global buffer with a fixed set of fields. A nil
+// Logger logs without fields.
+type Logger struct {
+	buf    *Buffer
+	fields []Field
+	key    string // fields as text, identifying them for flood suppression
+}
+
+// With returns a logger that adds the given fields to every entry. args
+// are alternating keys and values as in log/slog, or slog.Attr values.
+func With(args ...any) *Logger {
+	return (*Logger)(nil).With(args...)
+}
+
+// With returns a logger with the fields of l followed by args
+func (l *Logger) With(args ...any) *Logger {
+	n := &Logger{buf: l.buffer()}
+	if l != nil {
+		// Clip so that appending never writes into l's fields
+		n.fields = slices.Clip(l.fields)
+	}
+	n.fields = appendArgs(n.fields, args)
+	n.key = string(appendTextFields(nil, n.fields))
+	return n
+}
+
+func (l *Logger) Debug(format string, args ...any) { l.log(LevelDebug, format, args) }
+func (l *Logger) Info(format string, args ...any)  { l.log(LevelInfo, format, args) }
+func (l *Logger) Warn(format string, args ...any)  { l.log(LevelWarn, format, args) }
+func (l *Logger) Error(format string, args ...any) { l.log(LevelError, format, args) }
+
+// Enabled reports whether entries of level are recorded
+func (l *Logger) Enabled(level LogLevel) bool {
+	return l.buffer().Enabled(level)
+}
+
+// Handler returns a log/slog handler that logs with the fields of l
+func (l *Logger) Handler() slog.Handler {
+	h := &Handler{buf: l.buffer()}
+	if l != nil {
+		h.fields = l.fields
+	}
+	return h
+}
+
+func (l *Logger) log(level LogLevel, format string, args []any) {
+	if l == nil {
+		globalBuffer.log(level, nil, "", format, args)
+		return
+	}
+	l.buffer().log(level, l.fields, l.key, format, args)
+}
+
+func (l *Logger) buffer() *Buffer {
+	if l == nil || l.buf == nil {
+		return globalBuffer
+	}
+	return l.buf
+}
+
+// appendArgs converts alternating keys and values to fields. Like
+// log/slog, a value without a key is recorded under "!BADKEY".
+func appendArgs(fields []Field, args []any) []Field {
+	for len(args) > 0 {
+		switch a := args[0].(type) {
+		case slog.Attr:
+			fields = appendAttr(fields, "", a)
+			args = args[1:]
+		case string:
+			if len(args) == 1 {
+				fields = append(fields, Field{Key: "!BADKEY", Value: a})
+				return fields
+			}
+			fields = append(fields, Field{Key: a, Value: args[1]})
+			args = args[2:]
+		default:
+			fields = append(fields, Field{Key: "!BADKEY", Value: a})
+			args = args[1:]
+		}
+	}
+	return fields
+}
@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// Handler is a log/slog handler that records into the log buffer, so
+// libraries using log/slog show up in the GUI and in headless output
+type Handler struct {
+	buf    *Buffer
+	fields []Field
+	prefix string // Group prefix of attribute keys, e.g. "http."
+}
+
+// NewHandler returns a handler for the global buffer
+func NewHandler() *Handler {
+	return &Handler{buf: globalBuffer}
+}
+
+// Enabled implements slog.Handler
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.buf.Enabled(levelFromSlog(level))
+}
+
+// Handle implements slog.Handler
+func (h *Handler) Handle(_ context.Context, r slog.Record) error {
+	fields := slices.Clip(h.fields)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, a)
+		return true
+	})
+
+	level := levelFromSlog(r.Level)
+	key := floodKey{level: level, message: r.Message, fields: string(appendTextFields(nil, fields))}
+	if !h.buf.flood.allow(key) {
+		return nil
+	}
+
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	entry := Entry{
+		Time:    t,
+		Level:   level,
+		Message: r.Message,
+		Fields:  fields,
+	}
+	h.buf.add(entry)
+	h.buf.flood.logged(key, entry)
+	return nil
+}
+
+// WithAttrs implements slog.Handler
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	n := *h
+	n.fields = slices.Clip(h.fields)
+	for _, a := range attrs {
+		n.fields = appendAttr(n.fields, h.prefix, a)
+	}
+	return &n
+}
+
+// WithGroup implements slog.Handler
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	n := *h
+	n.prefix = h.prefix + name + "."
+	return &n
+}
+
+// appendAttr adds a as a field, flattening groups into dotted keys
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{Key: prefix + a.Key, Value: a.Value.Any()})
+}
+
+// levelFromSlog maps slog levels, which may lie between the named ones,
+// to the next lower LogLevel
+func levelFromSlog(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
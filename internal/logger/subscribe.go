@@ -0,0 +1,128 @@
+package logger
+
+import "sync"
+
+// Subscription delivers the entries logged after it was created on C. A
+// subscriber that falls behind by more than the capacity of C misses
+// entries; WithMissed recovers those still in the buffer.
+type Subscription struct {
+	C <-chan Entry
+
+	b        *Buffer
+	ch       chan Entry
+	lossless bool   // Logging waits for room on C rather than dropping entries
+	last     uint64 // Seq of the last entry returned by WithMissed
+	once     sync.Once
+}
+
+// Subscribe returns the buffered entries logged after seq, oldest first,
+// and a subscription to the entries logged from then on. seq 0 returns
+// the whole buffer. size is the capacity of the subscription's channel.
+func (b *Buffer) Subscribe(seq uint64, size int) (*Subscription, []Entry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.subscribeLocked(size, false), b.sinceLocked(seq)
+}
+
+// subscribeLocked adds a subscription. A lossless one never misses
+// entries: logging blocks while C is full, so its receiver must not log
+// or take b.mu. The caller must hold b.mu.
+func (b *Buffer) subscribeLocked(size int, lossless bool) *Subscription {
+	ch := make(chan Entry, size)
+	s := &Subscription{C: ch, b: b, ch: ch, lossless: lossless, last: b.seq}
+	b.subs = append(b.subs, s)
+	return s
+}
+
+// Since returns the buffered entries logged after seq, oldest first
+func (b *Buffer) Since(seq uint64) []Entry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.sinceLocked(seq)
+}
+
+// sinceLocked relies on entries having consecutive sequence numbers. The
+// caller must hold b.mu.
+func (b *Buffer) sinceLocked(seq uint64) []Entry {
+	n := len(b.entries)
+	if seq < b.seq && b.seq-seq < uint64(n) {
+		n = int(b.seq - seq)
+	} else if seq >= b.seq {
+		n = 0
+	}
+	result := make([]Entry, n)
+	copy(result, b.entries[len(b.entries)-n:])
+	return result
+}
+
+// publish hands entry to the subscribers, waiting only for lossless
+// ones. The caller must hold b.mu.
+func (b *Buffer) publish(entry Entry) {
+	for _, s := range b.subs {
+		if s.lossless {
+			s.ch <- entry
+			continue
+		}
+		select {
+		case s.ch <- entry:
+		default:
+			// Full; the subscriber catches up with WithMissed
+		}
+	}
+}
+
+// WithMissed returns e, preceded by the entries that were dropped before
+// it because C was full, as far as they are still buffered. Entries
+// already returned are skipped, so the result may be empty. Call it for
+// every entry received from C.
+func (s *Subscription) WithMissed(e Entry) []Entry {
+	if e.Seq <= s.last {
+		return nil
+	}
+	var missed []Entry
+	if e.Seq > s.last+1 {
+		missed = s.b.Since(s.last)
+		missed = missed[:len(missed)-countFrom(missed, e.Seq)]
+	}
+	s.last = e.Seq
+	return append(missed, e)
+}
+
+// countFrom returns how many of entries, which are in order, have a
+// sequence number of at least seq
+func countFrom(entries []Entry, seq uint64) int {
+	for i, e := range entries {
+		if e.Seq >= seq {
+			return len(entries) - i
+		}
+	}
+	return 0
+}
+
+// Close stops the subscription and closes C. Entries already on C can
+// still be received.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		b := s.b
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, sub := range b.subs {
+			if sub == s {
+				b.subs = append(b.subs[:i], b.subs[i+1:]...)
+				break
+			}
+		}
+		close(s.ch)
+	})
+}
+
+// Since returns the logged entries after seq that are still buffered
+func Since(seq uint64) []Entry {
+	return globalBuffer.Since(seq)
+}
+
+// Subscribe returns the logged entries after seq and a subscription to new
+// ones, see Buffer.Subscribe
+func Subscribe(seq uint64, size int) (*Subscription, []Entry) {
+	return globalBuffer.Subscribe(seq, size)
+}
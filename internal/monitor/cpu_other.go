@@ -0,0 +1,10 @@
+//go:build !linux && !windows
+
+package monitor
+
+import "time"
+
+// processCPUTime is not implemented on this platform
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,22 @@
+package monitor
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime returns the user and kernel CPU time of the process
+func processCPUTime() (time.Duration, bool) {
+	var creation, exit, kernel, user syscall.Filetime
+	h, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, false
+	}
+	if err := syscall.GetProcessTimes(h, &creation, &exit, &kernel, &user); err != nil {
+		return 0, false
+	}
+	// Filetime counts 100-nanosecond intervals
+	k := uint64(kernel.HighDateTime)<<32 | uint64(kernel.LowDateTime)
+	u := uint64(user.HighDateTime)<<32 | uint64(user.LowDateTime)
+	return time.Duration((k + u) * 100), true
+}
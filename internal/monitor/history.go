@@ -0,0 +1,85 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+)
+
+// History resolution and length: one sample per second for the last hour
+const (
+	HistoryInterval = time.Second
+	HistorySize     = 3600
+)
+
+// History keeps the most recent samples in a fixed-size ring buffer
+type History[T any] struct {
+	mu      sync.Mutex
+	samples []T
+	next    int // Index the next sample is written to
+	full    bool
+}
+
+// NewHistory creates a history holding up to size samples
+func NewHistory[T any](size int) *History[T] {
+	return &History[T]{samples: make([]T, size)}
+}
+
+// Add appends a sample, dropping the oldest one when full
+func (h *History[T]) Add(v T) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples[h.next] = v
+	h.next++
+	if h.next == len(h.samples) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// Last returns up to n of the most recent samples, oldest first. n <= 0
+// returns all samples.
+func (h *History[T]) Last(n int) []T {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	count := h.next
+	if h.full {
+		count = len(h.samples)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+
+	result := make([]T, n)
+	start := h.next - n
+	if start >= 0 {
+		copy(result, h.samples[start:h.next])
+	} else {
+		// Wraps around the end of the buffer
+		k := copy(result, h.samples[len(h.samples)+start:])
+		copy(result[k:], h.samples[:h.next])
+	}
+	return result
+}
+
+// Sample is a point in the system history
+type Sample struct {
+	Time time.Time
+	Stats
+}
+
+var globalHistory = NewHistory[Sample](HistorySize)
+
+// Record updates the global monitor and adds the result to the system
+// history. It is called once per HistoryInterval while the server runs.
+func Record(now time.Time) {
+	globalMonitor.Update()
+	globalHistory.Add(Sample{Time: now, Stats: globalMonitor.Get()})
+}
+
+// GetHistory returns up to n of the most recent system samples, oldest
+// first; n <= 0 returns the whole history
+func GetHistory(n int) []Sample {
+	return globalHistory.Last(n)
+}
@@ -4,15 +4,28 @@ import (
 	"fmt"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// minRateInterval is the shortest interval rates are computed over. The
+// GUI and the history sampler both update once a second; only one of them
+// computes new rates.
+const minRateInterval = 900 * time.Millisecond
+
 // Stats contains system monitoring statistics
 type Stats struct {
 	MemAllocMB    float64
 	MemSysMB      float64
 	NumGoroutines int
 	Uptime        time.Duration
+
+	CPUPercent   float64 // Process CPU time per wall time; 100 is one core
+	CPUAvailable bool    // Whether CPU usage can be measured on this platform
+	IngestBps    int64   // Bytes per second received from publishers
+	EgressBps    int64   // Bytes per second sent to viewers
+	RTMPConns    int     // Open RTMP connections
+	HTTPConns    int     // Open HLS connections
 }
 
 // Monitor tracks system resource usage
@@ -20,6 +33,18 @@ type Monitor struct {
 	mu        sync.Mutex
 	stats     Stats
 	startTime time.Time
+
+	// State of the previous rate computation
+	lastUpdate time.Time
+	lastCPU    time.Duration
+	lastIngest int64
+	lastEgress int64
+
+	// Counters updated by the servers
+	ingest    atomic.Int64
+	egress    atomic.Int64
+	rtmpConns atomic.Int64
+	httpConns atomic.Int64
 }
 
 var (
@@ -41,6 +66,26 @@ func (m *Monitor) Update() {
 	m.stats.MemSysMB = float64(memStats.Sys) / 1024 / 1024
 	m.stats.NumGoroutines = runtime.NumGoroutine()
 	m.stats.Uptime = time.Since(m.startTime)
+	m.stats.RTMPConns = int(m.rtmpConns.Load())
+	m.stats.HTTPConns = int(m.httpConns.Load())
+
+	now := time.Now()
+	elapsed := now.Sub(m.lastUpdate)
+	if elapsed < minRateInterval {
+		return
+	}
+
+	cpu, cpuOK := processCPUTime()
+	ingest, egress := m.ingest.Load(), m.egress.Load()
+	if !m.lastUpdate.IsZero() {
+		m.stats.IngestBps = int64(float64(ingest-m.lastIngest) / elapsed.Seconds())
+		m.stats.EgressBps = int64(float64(egress-m.lastEgress) / elapsed.Seconds())
+		if cpuOK {
+			m.stats.CPUPercent = float64(cpu-m.lastCPU) / float64(elapsed) * 100
+		}
+	}
+	m.stats.CPUAvailable = cpuOK
+	m.lastUpdate, m.lastCPU, m.lastIngest, m.lastEgress = now, cpu, ingest, egress
 }
 
 // Get returns current stats
@@ -60,6 +105,26 @@ func UpdateStats() {
 	globalMonitor.Update()
 }
 
+// AddIngest counts bytes received from publishers
+func AddIngest(n int64) {
+	globalMonitor.ingest.Add(n)
+}
+
+// AddEgress counts bytes sent to viewers
+func AddEgress(n int64) {
+	globalMonitor.egress.Add(n)
+}
+
+// AddRTMPConns adjusts the number of open RTMP connections by delta
+func AddRTMPConns(delta int) {
+	globalMonitor.rtmpConns.Add(int64(delta))
+}
+
+// AddHTTPConns adjusts the number of open HTTP connections by delta
+func AddHTTPConns(delta int) {
+	globalMonitor.httpConns.Add(int64(delta))
+}
+
 // FormatUptime returns human-readable uptime
 func FormatUptime(d time.Duration) string {
 	h := int(d.Hours())
@@ -0,0 +1,81 @@
+package synth
+
+import (
+	"time"
+
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+)
+
+// samplesPerFrame is the length of an AAC-LC frame
+const samplesPerFrame = 1024
+
+// AAC syntax element IDs
+const (
+	elementSCE = 0 // single_channel_element
+	elementCPE = 1 // channel_pair_element
+	elementEND = 7
+)
+
+// Audio generates an AAC-LC stream of silence
+type Audio struct {
+	SampleRate int
+	Channels   int // 1 or 2
+
+	frame int
+}
+
+// NewAudio returns a generator for 44.1 kHz stereo
+func NewAudio() *Audio {
+	return &Audio{SampleRate: 44100, Channels: 2}
+}
+
+// Config returns the AudioSpecificConfig of the stream
+func (a *Audio) Config() *mpeg4audio.AudioSpecificConfig {
+	return &mpeg4audio.AudioSpecificConfig{
+		Type:         mpeg4audio.ObjectTypeAACLC,
+		SampleRate:   a.SampleRate,
+		ChannelCount: a.Channels,
+	}
+}
+
+// Next returns the next access unit and its timestamp
+func (a *Audio) Next() (pts time.Duration, au []byte) {
+	pts = a.NextPTS()
+	a.frame++
+
+	// A raw_data_block with one element whose spectrum is all zero
+	var w bitWriter
+	if a.Channels == 1 {
+		w.bits(elementSCE, 3)
+		w.bits(0, 4) // element_instance_tag
+		silentChannel(&w)
+	} else {
+		w.bits(elementCPE, 3)
+		w.bits(0, 4)  // element_instance_tag
+		w.flag(false) // common_window
+		silentChannel(&w)
+		silentChannel(&w)
+	}
+	w.bits(elementEND, 3)
+	w.align()
+	return pts, w.buf
+}
+
+// NextPTS returns the timestamp of the access unit Next returns next
+func (a *Audio) NextPTS() time.Duration {
+	return time.Duration(a.frame) * samplesPerFrame * time.Second / time.Duration(a.SampleRate)
+}
+
+// silentChannel writes an individual_channel_stream without any scale
+// factor bands, i.e. silence
+func silentChannel(w *bitWriter) {
+	w.bits(100, 8) // global_gain
+	w.flag(false)  // ics_reserved_bit
+	w.bits(0, 2)   // window_sequence: ONLY_LONG_SEQUENCE
+	w.flag(false)  // window_shape
+	w.bits(0, 6)   // max_sfb
+	w.flag(false)  // predictor_data_present
+	w.flag(false)  // pulse_data_present
+	w.flag(false)  // tns_data_present
+	w.flag(false)  // gain_control_data_present
+}
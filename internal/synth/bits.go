@@ -0,0 +1,62 @@
+package synth
+
+// bitWriter builds an RBSP bit by bit, most significant bit first
+type bitWriter struct {
+	buf  []byte
+	used int // Bits used in the last byte; 0 when it is full or none
+}
+
+// bits writes the n least significant bits of v
+func (w *bitWriter) bits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.used == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>i&1 != 0 {
+			w.buf[len(w.buf)-1] |= 0x80 >> w.used
+		}
+		w.used = (w.used + 1) % 8
+	}
+}
+
+func (w *bitWriter) flag(b bool) {
+	if b {
+		w.bits(1, 1)
+	} else {
+		w.bits(0, 1)
+	}
+}
+
+// ue writes an unsigned Exp-Golomb code
+func (w *bitWriter) ue(v uint32) {
+	x := uint64(v) + 1
+	n := 0
+	for x>>n > 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(x, n+1)
+}
+
+// se writes a signed Exp-Golomb code
+func (w *bitWriter) se(v int32) {
+	if v > 0 {
+		w.ue(uint32(2*v - 1))
+	} else {
+		w.ue(uint32(-2 * v))
+	}
+}
+
+// align pads with zero bits to the next byte boundary
+func (w *bitWriter) align() {
+	if w.used != 0 {
+		w.bits(0, 8-w.used)
+	}
+}
+
+// trailing writes rbsp_trailing_bits and returns the RBSP
+func (w *bitWriter) trailing() []byte {
+	w.bits(1, 1)
+	w.align()
+	return w.buf
+}
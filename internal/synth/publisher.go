@@ -0,0 +1,130 @@
+package synth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortmplib"
+	"github.com/bluenviron/gortmplib/pkg/codecs"
+)
+
+// Publisher sends synthetic video and audio to an RTMP server, paced by
+// their timestamps like a live encoder
+type Publisher struct {
+	URL   string // e.g. rtmp://127.0.0.1:1935/live/test
+	Video *Video
+	Audio *Audio  // nil publishes video only
+	Speed float64 // Media time sent per wall-clock time; 0 is real time
+
+	mu     sync.Mutex
+	resume chan struct{} // Non-nil while paused, closed by Resume
+}
+
+// Pause stops sending while keeping the connection open, like a stalled
+// encoder
+func (p *Publisher) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resume == nil {
+		p.resume = make(chan struct{})
+	}
+}
+
+// Resume continues sending after Pause, from where it stopped
+func (p *Publisher) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resume != nil {
+		close(p.resume)
+		p.resume = nil
+	}
+}
+
+func (p *Publisher) paused() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resume
+}
+
+// Publish connects and sends the stream until ctx is done, which returns
+// nil, or the connection fails
+func (p *Publisher) Publish(ctx context.Context) error {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return err
+	}
+	c := &gortmplib.Client{URL: u, Publish: true}
+	if err := c.Initialize(ctx); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", p.URL, err)
+	}
+	defer c.Close()
+
+	// Closing the connection ends a blocked write
+	stop := context.AfterFunc(ctx, c.Close)
+	defer stop()
+
+	videoTrack := &gortmplib.Track{Codec: &codecs.H264{SPS: p.Video.SPS(), PPS: p.Video.PPS()}}
+	tracks := []*gortmplib.Track{videoTrack}
+	var audioTrack *gortmplib.Track
+	if p.Audio != nil {
+		audioTrack = &gortmplib.Track{Codec: &codecs.MPEG4Audio{Config: p.Audio.Config()}}
+		tracks = append(tracks, audioTrack)
+	}
+
+	w := &gortmplib.Writer{Conn: c, Tracks: tracks}
+	if err := w.Initialize(); err != nil {
+		return fmt.Errorf("failed to announce tracks: %w", err)
+	}
+
+	speed := p.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		// Send whichever track is behind, so that they stay interleaved
+		next := p.Video.NextPTS()
+		audio := p.Audio != nil && p.Audio.NextPTS() < next
+		if audio {
+			next = p.Audio.NextPTS()
+		}
+
+		if resume := p.paused(); resume != nil {
+			pausedAt := time.Now()
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-resume:
+			}
+			// Media time stood still while paused
+			start = start.Add(time.Since(pausedAt))
+		}
+
+		timer.Reset(time.Until(start.Add(time.Duration(float64(next) / speed))))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+
+		if audio {
+			pts, au := p.Audio.Next()
+			err = w.WriteMPEG4Audio(audioTrack, pts, au)
+		} else {
+			pts, au := p.Video.Next()
+			err = w.WriteH264(videoTrack, pts, pts, au)
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
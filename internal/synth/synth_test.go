@@ -0,0 +1,110 @@
+package synth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+)
+
+func TestVideoParameterSets(t *testing.T) {
+	v := &Video{Width: 320, Height: 240, FPS: 25, GOP: 50}
+
+	var sps h264.SPS
+	if err := sps.Unmarshal(v.SPS()); err != nil {
+		t.Fatalf("SPS does not parse: %v", err)
+	}
+	if sps.Width() != 320 || sps.Height() != 240 {
+		t.Errorf("size = %dx%d, want 320x240", sps.Width(), sps.Height())
+	}
+	if sps.FPS() != 25 {
+		t.Errorf("fps = %v, want 25", sps.FPS())
+	}
+	if sps.ProfileIdc != 66 {
+		t.Errorf("profile_idc = %d, want 66", sps.ProfileIdc)
+	}
+	if typ := h264.NALUType(v.PPS()[0] & 0x1f); typ != h264.NALUTypePPS {
+		t.Errorf("PPS NAL unit type = %v", typ)
+	}
+}
+
+func TestVideoAccessUnits(t *testing.T) {
+	v := &Video{Width: 64, Height: 48, FPS: 10, GOP: 5}
+	dts := h264.NewDTSExtractor()
+
+	for i := range 12 {
+		if want := time.Duration(i) * 100 * time.Millisecond; v.NextPTS() != want {
+			t.Fatalf("frame %d: NextPTS = %v, want %v", i, v.NextPTS(), want)
+		}
+		pts, au := v.Next()
+		if idr := h264.IDRPresent(au); idr != (i%5 == 0) {
+			t.Errorf("frame %d: IDR = %t", i, idr)
+		}
+		if got, err := dts.Extract(au, pts); err != nil || got != pts {
+			t.Errorf("frame %d: DTS = %v, %v; want %v", i, got, err, pts)
+		}
+		for _, nalu := range au {
+			if hasStartCode(nalu) {
+				t.Errorf("frame %d: NAL unit type %d contains a start code", i, nalu[0]&0x1f)
+			}
+		}
+	}
+	if v.KeyframeInterval() != 500*time.Millisecond {
+		t.Errorf("KeyframeInterval = %v", v.KeyframeInterval())
+	}
+}
+
+func TestNALUEmulationPrevention(t *testing.T) {
+	got := nalu(0x65, []byte{0, 0, 0, 0, 0, 1, 0, 0, 4})
+	want := []byte{0x65, 0, 0, 3, 0, 0, 3, 0, 1, 0, 0, 4}
+	if string(got) != string(want) {
+		t.Errorf("nalu = % x, want % x", got, want)
+	}
+	if string(h264.EmulationPreventionRemove(got[1:])) != string([]byte{0, 0, 0, 0, 0, 1, 0, 0, 4}) {
+		t.Errorf("emulation prevention does not round-trip")
+	}
+}
+
+func TestAudio(t *testing.T) {
+	for _, tc := range []struct {
+		channels int
+		element  byte
+		size     int
+	}{
+		{1, elementSCE, 4},
+		{2, elementCPE, 7},
+	} {
+		channels := tc.channels
+		a := &Audio{SampleRate: 48000, Channels: channels}
+
+		enc, err := a.Config().Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var conf mpeg4audio.AudioSpecificConfig
+		if err := conf.Unmarshal(enc); err != nil || conf.ChannelCount != channels || conf.SampleRate != 48000 {
+			t.Errorf("config = %+v, %v", conf, err)
+		}
+
+		a.Next()
+		pts, au := a.Next()
+		if pts != time.Second*1024/48000 {
+			t.Errorf("second frame pts = %v", pts)
+		}
+		if len(au) != tc.size || au[0]>>5 != tc.element {
+			t.Errorf("%d channels: access unit = % x", channels, au)
+		}
+	}
+}
+
+// hasStartCode reports whether b contains a start code prefix or a
+// sequence reserved for one
+func hasStartCode(b []byte) bool {
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] == 0 && b[i+1] == 0 && b[i+2] <= 2 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,187 @@
+package synth
+
+import "time"
+
+// NAL unit headers: nal_ref_idc and nal_unit_type
+const (
+	naluSPS    = 0x67
+	naluPPS    = 0x68
+	naluIDR    = 0x65
+	naluNonIDR = 0x41
+)
+
+// Bit lengths of frame_num; frame_num counts frames since the last IDR
+const log2MaxFrameNum = 8
+
+// I_PCM, the macroblock type that carries raw samples, in I slices
+const mbTypeIPCM = 25
+
+// Video generates an H.264 Constrained Baseline stream that decoders
+// accept: every GOP starts with an IDR frame of a flat gray picture, coded
+// as raw macroblocks, and continues with P frames that skip every
+// macroblock. The brightness changes from one GOP to the next.
+type Video struct {
+	Width  int // Multiple of 16
+	Height int // Multiple of 16
+	FPS    int
+	GOP    int // Frames per GOP, so a keyframe every GOP/FPS seconds
+
+	frame int
+}
+
+// NewVideo returns a generator for a small 30 fps stream with a keyframe
+// every second
+func NewVideo() *Video {
+	return &Video{Width: 128, Height: 96, FPS: 30, GOP: 30}
+}
+
+// SPS returns the sequence parameter set, with timing information for
+// the frame rate
+func (v *Video) SPS() []byte {
+	var w bitWriter
+	w.bits(66, 8)   // profile_idc: Baseline
+	w.bits(0xc0, 8) // constraint_set0_flag, constraint_set1_flag
+	w.bits(30, 8)   // level_idc: 3.0
+	w.ue(0)         // seq_parameter_set_id
+	w.ue(log2MaxFrameNum - 4)
+	w.ue(2)       // pic_order_cnt_type: order follows frame_num
+	w.ue(1)       // max_num_ref_frames
+	w.flag(false) // gaps_in_frame_num_value_allowed_flag
+	w.ue(uint32(v.Width/16 - 1))
+	w.ue(uint32(v.Height/16 - 1))
+	w.flag(true)  // frame_mbs_only_flag
+	w.flag(true)  // direct_8x8_inference_flag
+	w.flag(false) // frame_cropping_flag
+
+	w.flag(true)  // vui_parameters_present_flag
+	w.flag(false) // aspect_ratio_info_present_flag
+	w.flag(false) // overscan_info_present_flag
+	w.flag(false) // video_signal_type_present_flag
+	w.flag(false) // chroma_loc_info_present_flag
+	w.flag(true)  // timing_info_present_flag
+	w.bits(1, 32) // num_units_in_tick
+	w.bits(uint64(2*v.FPS), 32)
+	w.flag(true)  // fixed_frame_rate_flag
+	w.flag(false) // nal_hrd_parameters_present_flag
+	w.flag(false) // vcl_hrd_parameters_present_flag
+	w.flag(false) // pic_struct_present_flag
+	w.flag(false) // bitstream_restriction_flag
+	return nalu(naluSPS, w.trailing())
+}
+
+// PPS returns the picture parameter set
+func (v *Video) PPS() []byte {
+	var w bitWriter
+	w.ue(0)       // pic_parameter_set_id
+	w.ue(0)       // seq_parameter_set_id
+	w.flag(false) // entropy_coding_mode_flag: CAVLC
+	w.flag(false) // bottom_field_pic_order_in_frame_present_flag
+	w.ue(0)       // num_slice_groups_minus1
+	w.ue(0)       // num_ref_idx_l0_default_active_minus1
+	w.ue(0)       // num_ref_idx_l1_default_active_minus1
+	w.flag(false) // weighted_pred_flag
+	w.bits(0, 2)  // weighted_bipred_idc
+	w.se(0)       // pic_init_qp_minus26
+	w.se(0)       // pic_init_qs_minus26
+	w.se(0)       // chroma_qp_index_offset
+	w.flag(true)  // deblocking_filter_control_present_flag
+	w.flag(false) // constrained_intra_pred_flag
+	w.flag(false) // redundant_pic_cnt_present_flag
+	return nalu(naluPPS, w.trailing())
+}
+
+// Next returns the next access unit and its timestamp. IDR access units
+// carry the SPS and PPS in front, like encoders send them.
+func (v *Video) Next() (pts time.Duration, au [][]byte) {
+	pts = v.pts(v.frame)
+	n := v.frame % v.GOP
+	if n == 0 {
+		au = [][]byte{v.SPS(), v.PPS(), v.idr(v.frame / v.GOP)}
+	} else {
+		au = [][]byte{v.skip(n)}
+	}
+	v.frame++
+	return pts, au
+}
+
+// NextPTS returns the timestamp of the access unit Next returns next
+func (v *Video) NextPTS() time.Duration {
+	return v.pts(v.frame)
+}
+
+func (v *Video) pts(frame int) time.Duration {
+	return time.Duration(frame) * time.Second / time.Duration(v.FPS)
+}
+
+// KeyframeInterval returns the time between IDR frames
+func (v *Video) KeyframeInterval() time.Duration {
+	return v.pts(v.GOP)
+}
+
+// idr returns an IDR slice of gop's flat picture
+func (v *Video) idr(gop int) []byte {
+	var w bitWriter
+	w.ue(0) // first_mb_in_slice
+	w.ue(7) // slice_type: I, as are all slices of the picture
+	w.ue(0) // pic_parameter_set_id
+	w.bits(0, log2MaxFrameNum)
+	w.ue(uint32(gop % 2)) // idr_pic_id differs between consecutive IDRs
+	w.flag(false)         // no_output_of_prior_pics_flag
+	w.flag(false)         // long_term_reference_flag
+	w.se(0)               // slice_qp_delta
+	w.ue(1)               // disable_deblocking_filter_idc
+
+	luma := byte(40 + gop*37%180)
+	for range v.macroblocks() {
+		w.ue(mbTypeIPCM)
+		w.align()
+		for range 256 {
+			w.bits(uint64(luma), 8)
+		}
+		for range 2 * 64 {
+			w.bits(128, 8)
+		}
+	}
+	return nalu(naluIDR, w.trailing())
+}
+
+// skip returns a P slice that repeats the previous picture
+func (v *Video) skip(frameNum int) []byte {
+	var w bitWriter
+	w.ue(0) // first_mb_in_slice
+	w.ue(5) // slice_type: P, as are all slices of the picture
+	w.ue(0) // pic_parameter_set_id
+	w.bits(uint64(frameNum), log2MaxFrameNum)
+	w.flag(false) // num_ref_idx_active_override_flag
+	w.flag(false) // ref_pic_list_modification_flag_l0
+	w.flag(false) // adaptive_ref_pic_marking_mode_flag
+	w.se(0)       // slice_qp_delta
+	w.ue(1)       // disable_deblocking_filter_idc
+	w.ue(uint32(v.macroblocks()))
+	return nalu(naluNonIDR, w.trailing())
+}
+
+func (v *Video) macroblocks() int {
+	return (v.Width / 16) * (v.Height / 16)
+}
+
+// nalu prefixes an RBSP with its header and inserts emulation prevention
+// bytes, so that no start code appears inside
+func nalu(header byte, rbsp []byte) []byte {
+	out := make([]byte, 1, len(rbsp)+len(rbsp)/64+1)
+	out[0] = header
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
@@ -1,14 +1,33 @@
 package main
 
 import (
+	"flag"
+	"log/slog"
+	"os"
 	"runtime"
 
-	"rtmp_server/gui"
+	"rtmp_server/internal/config"
+	"rtmp_server/internal/logger"
 )
 
 func main() {
 	// Use all available CPU cores for multi-threading
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	gui.Main()
+	headless := flag.Bool("headless", false, "run without GUI, logging to stderr (daemon mode)")
+	configPath := flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG"), "path to the config file (default: config.json next to the executable)")
+	profile := flag.String("profile", os.Getenv(config.EnvPrefix+"PROFILE"), "named config profile, e.g. staging loads config.staging.json")
+	flag.Parse()
+
+	// Route log/slog and the standard log package through our logger
+	slog.SetDefault(slog.New(logger.NewHandler()))
+
+	config.SetPath(*configPath)
+	config.SetProfile(*profile)
+
+	if *headless || !guiAvailable {
+		os.Exit(runHeadless())
+	}
+
+	runGUI()
 }
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+
+	"rtmp_server/internal/logger"
+)
+
+// ipACL is a CIDR-based allow/deny list. Deny rules win over allow rules,
+// and an empty allow list permits every address that is not denied.
+type ipACL struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// newIPACL parses allow and deny rules. Entries may be CIDR prefixes
+// ("10.0.0.0/8") or single addresses; invalid entries are logged and skipped.
+func newIPACL(name string, allow, deny []string) *ipACL {
+	return &ipACL{
+		allow: parsePrefixes(name, allow),
+		deny:  parsePrefixes(name, deny),
+	}
+}
+
+func parsePrefixes(name string, rules []string) []netip.Prefix {
+	result := make([]netip.Prefix, 0, len(rules))
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		if strings.Contains(rule, "/") {
+			prefix, err := netip.ParsePrefix(rule)
+			if err != nil {
+				logger.Warn("Ignoring invalid %s rule %q: %v", name, rule, err)
+				continue
+			}
+			result = append(result, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(rule)
+		if err != nil {
+			logger.Warn("Ignoring invalid %s rule %q: %v", name, rule, err)
+			continue
+		}
+		addr = addr.Unmap()
+		result = append(result, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return result
+}
+
+// Permits reports whether the given address passes the rules.
+// A nil ACL permits everything.
+func (a *ipACL) Permits(addr netip.Addr) bool {
+	if a == nil {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, p := range a.deny {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+	if len(a.allow) == 0 {
+		return true
+	}
+	for _, p := range a.allow {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// PermitsAddr is like Permits for a "host:port" address string.
+// Unparsable addresses are only permitted when there are no rules at all.
+func (a *ipACL) PermitsAddr(hostport string) bool {
+	if a == nil {
+		return true
+	}
+	addr, ok := remoteIP(hostport)
+	if !ok {
+		return len(a.allow) == 0 && len(a.deny) == 0
+	}
+	return a.Permits(addr)
+}
+
+// remoteIP extracts the IP from a "host:port" remote address
+func remoteIP(hostport string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
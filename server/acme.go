@@ -0,0 +1,305 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"rtmp_server/internal/logger"
+)
+
+const (
+	// acmeCheckInterval is how often the ACME certificate is refreshed;
+	// autocert renews it 30 days before expiry
+	acmeCheckInterval = 12 * time.Hour
+	// acmeRetryInterval is how long to wait after a failed order, which
+	// keeps well below Let's Encrypt's failed validation limit
+	acmeRetryInterval = 10 * time.Minute
+)
+
+// ACMESettings configures certificate management through an ACME CA such
+// as Let's Encrypt
+type ACMESettings struct {
+	Enabled      bool
+	Domain       string
+	Email        string
+	DirectoryURL string
+	CACert       string // PEM file with an extra CA trusted for the directory
+	CacheDir     string
+	HTTPAddr     string // Listen address for HTTP-01 challenges; empty disables HTTP-01
+}
+
+// acmeProvider obtains and renews the certificate for one domain.
+// TLS-ALPN-01 challenges are answered through GetCertificate on the HTTPS
+// listener, HTTP-01 challenges by a separate plain HTTP listener.
+type acmeProvider struct {
+	settings  ACMESettings
+	manager   *autocert.Manager
+	challenge *http.Server // nil without HTTP-01
+
+	expiry atomic.Int64 // Unix seconds of the leaf's NotAfter, 0 before the first certificate
+	mu     sync.Mutex   // Protects warner
+	warner expiryWarner
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newACMEProvider sets up the ACME client and starts obtaining the
+// certificate in the background. httpsAddr is used to redirect plain HTTP
+// requests on the challenge listener.
+func newACMEProvider(s ACMESettings, httpsAddr string) (*acmeProvider, error) {
+	httpClient, err := acmeHTTPClient(s.CACert)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &acmeProvider{
+		settings: s,
+		manager: &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(s.CacheDir),
+			HostPolicy: autocert.HostWhitelist(s.Domain),
+			Email:      s.Email,
+			Client: &acme.Client{
+				DirectoryURL: s.DirectoryURL,
+				HTTPClient:   httpClient,
+			},
+		},
+		warner: expiryWarner{name: s.Domain},
+		done:   make(chan struct{}),
+	}
+
+	if s.HTTPAddr != "" {
+		listener, err := net.Listen("tcp", s.HTTPAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen for ACME HTTP-01 challenges: %w", err)
+		}
+		p.challenge = &http.Server{Handler: stripHostPort(p.manager.HTTPHandler(httpsRedirect(httpsAddr)))}
+		logger.Info("ACME HTTP-01 challenge server started on %s", s.HTTPAddr)
+		go func() {
+			if err := p.challenge.Serve(listener); err != nil && err != http.ErrServerClosed {
+				logger.Error("ACME challenge server error: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("🔒 ACME enabled for %s (directory %s, cache %s)", s.Domain, s.DirectoryURL, s.CacheDir)
+	go p.maintain()
+	return p, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (p *acmeProvider) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName == "" {
+		// Clients connecting by IP address send no SNI
+		h := *hello
+		h.ServerName = p.settings.Domain
+		hello = &h
+	}
+
+	cert, err := p.manager.GetCertificate(hello)
+	if err != nil {
+		return nil, err
+	}
+	if !isChallengeHello(hello) && cert.Leaf != nil {
+		p.observe(cert.Leaf)
+	}
+	return cert, nil
+}
+
+// Expiry returns when the current certificate expires
+func (p *acmeProvider) Expiry() time.Time {
+	if t := p.expiry.Load(); t != 0 {
+		return time.Unix(t, 0)
+	}
+	return time.Time{}
+}
+
+// Close stops the challenge listener and background renewal checks
+func (p *acmeProvider) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		if p.challenge != nil {
+			p.challenge.Close()
+		}
+	})
+}
+
+// maintain obtains the certificate up front, so that the first viewer
+// does not wait for issuance and problems show up in the log right away,
+// then checks it periodically
+func (p *acmeProvider) maintain() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-timer.C:
+			if err := p.obtain(); err != nil {
+				logger.Error("ACME: failed to obtain certificate for %s: %v (retrying in %s)",
+					p.settings.Domain, err, acmeRetryInterval)
+				timer.Reset(acmeRetryInterval)
+				continue
+			}
+			timer.Reset(acmeCheckInterval)
+		}
+	}
+}
+
+// obtain requests the certificate the way a modern browser would, so the
+// ECDSA certificate most clients use is the one that gets issued
+func (p *acmeProvider) obtain() error {
+	_, err := p.GetCertificate(&tls.ClientHelloInfo{
+		ServerName:       p.settings.Domain,
+		CipherSuites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		SignatureSchemes: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedCurves:  []tls.CurveID{tls.CurveP256},
+	})
+	return err
+}
+
+// observe logs newly issued or renewed certificates and expiry warnings
+func (p *acmeProvider) observe(leaf *x509.Certificate) {
+	if old := p.expiry.Swap(leaf.NotAfter.Unix()); old != leaf.NotAfter.Unix() {
+		logger.Info("🔒 ACME certificate for %s from %s, expires %s (%s)",
+			certName(leaf), issuerName(leaf), leaf.NotAfter.Format("2006-01-02"), FormatExpiry(leaf.NotAfter))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.warner.check(leaf.NotAfter)
+}
+
+// isChallengeHello reports whether hello comes from a CA validating a
+// TLS-ALPN-01 challenge
+func isChallengeHello(hello *tls.ClientHelloInfo) bool {
+	return len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto
+}
+
+// acmeHTTPClient returns the client used to talk to the ACME directory.
+// caFile adds a trusted CA, e.g. Pebble's self-signed minica certificate.
+func acmeHTTPClient(caFile string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ACME CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("failed to read ACME CA certificate: no PEM certificates in " + caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: &orderLocationTransport{base: transport}}, nil
+}
+
+// orderLocationTransport works around x/crypto/acme polling an empty URL
+// when a finalize response has no Location header, which RFC 8555 allows
+// and Pebble does when it finalizes asynchronously. It remembers each
+// order's URL from the new-order response and adds it to the finalize
+// response.
+type orderLocationTransport struct {
+	base http.RoundTripper
+
+	mu     sync.Mutex
+	orders map[string]string // Finalize URL -> order URL
+}
+
+func (t *orderLocationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil || req.Method != http.MethodPost {
+		return res, err
+	}
+
+	location := res.Header.Get("Location")
+	if res.StatusCode == http.StatusCreated && location != "" {
+		// New accounts are created with 201 as well; only orders have a
+		// finalize URL
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return res, nil
+		}
+		var order struct {
+			Finalize string `json:"finalize"`
+		}
+		if json.Unmarshal(body, &order) == nil && order.Finalize != "" {
+			t.mu.Lock()
+			if t.orders == nil {
+				t.orders = make(map[string]string)
+			}
+			t.orders[order.Finalize] = location
+			t.mu.Unlock()
+		}
+		return res, nil
+	}
+
+	if location == "" {
+		t.mu.Lock()
+		orderURL, ok := t.orders[req.URL.String()]
+		delete(t.orders, req.URL.String())
+		t.mu.Unlock()
+		if ok {
+			res.Header.Set("Location", orderURL)
+		}
+	}
+	return res, nil
+}
+
+// httpsRedirect redirects plain HTTP requests to the HTTPS server
+func httpsRedirect(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusFound)
+	})
+}
+
+// stripHostPort removes the port from the Host header. autocert checks
+// the host policy against r.Host, which includes the port whenever the
+// challenge listener is not on port 80, e.g. when testing with Pebble.
+func stripHostPort(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if host, _, err := net.SplitHostPort(r.Host); err == nil {
+			r.Host = host
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// issuerName returns the organization or common name of the issuing CA
+func issuerName(leaf *x509.Certificate) string {
+	if len(leaf.Issuer.Organization) > 0 {
+		return leaf.Issuer.Organization[0]
+	}
+	return leaf.Issuer.CommonName
+}
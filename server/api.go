@@ -0,0 +1,422 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rtmp_server/internal/logger"
+	"rtmp_server/internal/monitor"
+)
+
+// apiStream is a stream in /api/streams
+type apiStream struct {
+	Key       string         `json:"key"`
+	Bitrate   int64          `json:"bitrate"` // Bytes per second
+	Viewers   int            `json:"viewers"`
+	StartedAt time.Time      `json:"started_at"`
+	Stats     apiStreamStats `json:"stats"`
+	Alerts    []apiAlert     `json:"alerts"`
+	Relays    []apiRelay     `json:"relays"`
+}
+
+// apiRelay is a push target in /api/relays and /api/streams
+type apiRelay struct {
+	Key         string     `json:"key"`
+	ID          string     `json:"id"`
+	URL         string     `json:"url"`    // Stream key masked
+	Source      string     `json:"source"` // "config" or "api"
+	State       RelayState `json:"state"`
+	Bitrate     int64      `json:"bitrate"` // Bytes per second
+	Reconnects  int        `json:"reconnects"`
+	Error       string     `json:"error,omitempty"` // Last error, kept after reconnecting
+	ErrorAt     time.Time  `json:"error_at,omitzero"`
+	RetryAt     time.Time  `json:"retry_at,omitzero"`
+	ConnectedAt time.Time  `json:"connected_at,omitzero"`
+}
+
+// maxRelayBody limits the body of POST /api/streams/{key}/relays
+const maxRelayBody = 4 << 10
+
+// apiAlert is an ongoing stream problem in /api/streams
+type apiAlert struct {
+	Kind    AlertKind `json:"kind"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+// apiStreamStats is StreamStats with durations in milliseconds
+type apiStreamStats struct {
+	FPS              float64 `json:"fps"`
+	GOPLength        int     `json:"gop_length"`
+	KeyframeInterval int64   `json:"keyframe_interval_ms"`
+	AVDrift          int64   `json:"av_drift_ms"`
+	Discontinuities  int64   `json:"discontinuities"`
+	DTSErrors        int64   `json:"dts_errors"`
+	VideoFrames      int64   `json:"video_frames"`
+	AudioFrames      int64   `json:"audio_frames"`
+	SegmentTarget    int64   `json:"segment_target_ms"`
+	SegmentAvg       int64   `json:"segment_avg_ms"`
+	SegmentMax       int64   `json:"segment_max_ms"`
+	Segments         int64   `json:"segments"`
+	KeyframeHint     string  `json:"keyframe_hint,omitempty"`
+}
+
+// apiServerStats is the body of /api/stats
+type apiServerStats struct {
+	CPUPercent    *float64 `json:"cpu_percent"` // null where not measurable
+	IngestBps     int64    `json:"ingest_bps"`  // Bytes per second
+	EgressBps     int64    `json:"egress_bps"`  // Bytes per second
+	RTMPConns     int      `json:"rtmp_connections"`
+	HTTPConns     int      `json:"http_connections"`
+	Streams       int      `json:"streams"`
+	MemAllocMB    float64  `json:"mem_alloc_mb"`
+	NumGoroutines int      `json:"goroutines"`
+	Uptime        int64    `json:"uptime_seconds"`
+}
+
+func newAPIServerStats(stats monitor.Stats, streams int) apiServerStats {
+	result := apiServerStats{
+		IngestBps:     stats.IngestBps,
+		EgressBps:     stats.EgressBps,
+		RTMPConns:     stats.RTMPConns,
+		HTTPConns:     stats.HTTPConns,
+		Streams:       streams,
+		MemAllocMB:    stats.MemAllocMB,
+		NumGoroutines: stats.NumGoroutines,
+		Uptime:        int64(stats.Uptime.Seconds()),
+	}
+	if stats.CPUAvailable {
+		result.CPUPercent = &stats.CPUPercent
+	}
+	return result
+}
+
+// apiStreamSample is a StreamSample in /api/streams/{key}/history
+type apiStreamSample struct {
+	Time    time.Time `json:"time"`
+	Bitrate int64     `json:"bitrate"` // Bytes per second
+	FPS     float64   `json:"fps"`
+	Viewers int       `json:"viewers"`
+}
+
+// apiSystemSample is a monitor.Sample in /api/stats/history
+type apiSystemSample struct {
+	Time          time.Time `json:"time"`
+	CPUPercent    *float64  `json:"cpu_percent"`
+	IngestBps     int64     `json:"ingest_bps"`
+	EgressBps     int64     `json:"egress_bps"`
+	RTMPConns     int       `json:"rtmp_connections"`
+	HTTPConns     int       `json:"http_connections"`
+	MemAllocMB    float64   `json:"mem_alloc_mb"`
+	NumGoroutines int       `json:"goroutines"`
+}
+
+func newAPISystemSample(s monitor.Sample) apiSystemSample {
+	result := apiSystemSample{
+		Time:          s.Time,
+		IngestBps:     s.IngestBps,
+		EgressBps:     s.EgressBps,
+		RTMPConns:     s.RTMPConns,
+		HTTPConns:     s.HTTPConns,
+		MemAllocMB:    s.MemAllocMB,
+		NumGoroutines: s.NumGoroutines,
+	}
+	if s.CPUAvailable {
+		result.CPUPercent = &s.CPUPercent
+	}
+	return result
+}
+
+func newAPIRelay(r RelayStatus) apiRelay {
+	source := "config"
+	if r.FromAPI {
+		source = "api"
+	}
+	return apiRelay{
+		Key:         r.Key,
+		ID:          r.ID,
+		URL:         r.URL,
+		Source:      source,
+		State:       r.State,
+		Bitrate:     r.Bitrate,
+		Reconnects:  r.Reconnects,
+		Error:       r.LastError,
+		ErrorAt:     r.ErrorAt,
+		RetryAt:     r.RetryAt,
+		ConnectedAt: r.ConnectedAt,
+	}
+}
+
+func newAPIRelays(relays []RelayStatus) []apiRelay {
+	result := make([]apiRelay, len(relays))
+	for i, r := range relays {
+		result[i] = newAPIRelay(r)
+	}
+	return result
+}
+
+func newAPIStream(s StreamInfo) apiStream {
+	alerts := make([]apiAlert, len(s.Alerts))
+	for i, a := range s.Alerts {
+		alerts[i] = apiAlert{Kind: a.Kind, Message: a.Message, Since: a.Since}
+	}
+	return apiStream{
+		Key:       s.Key,
+		Bitrate:   s.Bitrate,
+		Viewers:   s.Viewers,
+		StartedAt: s.StartTime,
+		Stats: apiStreamStats{
+			FPS:              s.Stats.FPS,
+			GOPLength:        s.Stats.GOPLength,
+			KeyframeInterval: s.Stats.KeyframeInterval.Milliseconds(),
+			AVDrift:          s.Stats.AVDrift.Milliseconds(),
+			Discontinuities:  s.Stats.Discontinuities,
+			DTSErrors:        s.Stats.DTSErrors,
+			VideoFrames:      s.Stats.VideoFrames,
+			AudioFrames:      s.Stats.AudioFrames,
+			SegmentTarget:    s.Stats.SegmentTarget.Milliseconds(),
+			SegmentAvg:       s.Stats.SegmentAvg.Milliseconds(),
+			SegmentMax:       s.Stats.SegmentMax.Milliseconds(),
+			Segments:         s.Stats.Segments,
+			KeyframeHint:     KeyframeHint(s.Stats),
+		},
+		Alerts: alerts,
+		Relays: newAPIRelays(s.Relays),
+	}
+}
+
+// registerAPI adds the API endpoints to mux. wrap is applied to every
+// handler.
+func (h *HTTPServer) registerAPI(mux *http.ServeMux, wrap func(http.HandlerFunc) http.HandlerFunc) {
+	// Stream list endpoint (JSON)
+	mux.HandleFunc("/api/streams", wrap(func(w http.ResponseWriter, r *http.Request) {
+		h.setAPICORS(w, r)
+		streams := h.manager.GetAllStreams()
+		result := make([]apiStream, len(streams))
+		for i, s := range streams {
+			result[i] = newAPIStream(s)
+		}
+		writeJSON(w, result)
+	}))
+
+	// Server resource usage and throughput
+	mux.HandleFunc("/api/stats", wrap(func(w http.ResponseWriter, r *http.Request) {
+		h.setAPICORS(w, r)
+		writeJSON(w, newAPIServerStats(monitor.GetStats(), h.manager.StreamCount()))
+	}))
+
+	// History of one stream, optionally limited to the last ?seconds=N
+	mux.HandleFunc("/api/streams/{key}/history", wrap(func(w http.ResponseWriter, r *http.Request) {
+		h.setAPICORS(w, r)
+		n, ok := historyLength(w, r)
+		if !ok {
+			return
+		}
+		samples, ok := h.manager.StreamHistory(r.PathValue("key"), n)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		result := make([]apiStreamSample, len(samples))
+		for i, s := range samples {
+			result[i] = apiStreamSample{Time: s.Time, Bitrate: s.Bitrate, FPS: s.FPS, Viewers: s.Viewers}
+		}
+		writeJSON(w, result)
+	}))
+
+	// History of the server stats, optionally limited to the last ?seconds=N
+	mux.HandleFunc("/api/stats/history", wrap(func(w http.ResponseWriter, r *http.Request) {
+		h.setAPICORS(w, r)
+		n, ok := historyLength(w, r)
+		if !ok {
+			return
+		}
+		samples := monitor.GetHistory(n)
+		result := make([]apiSystemSample, len(samples))
+		for i, s := range samples {
+			result[i] = newAPISystemSample(s)
+		}
+		writeJSON(w, result)
+	}))
+
+	// Push targets of every stream key, live or not
+	mux.HandleFunc("GET /api/relays", wrap(func(w http.ResponseWriter, r *http.Request) {
+		h.setAPICORS(w, r)
+		writeJSON(w, newAPIRelays(h.manager.Relays()))
+	}))
+
+	// Stream list endpoint (text, legacy)
+	mux.HandleFunc("/streams", wrap(func(w http.ResponseWriter, r *http.Request) {
+		streams := h.manager.GetAllStreams()
+		w.Header().Set("Content-Type", "text/plain")
+		for _, s := range streams {
+			w.Write([]byte(s.Key + "\n"))
+		}
+	}))
+}
+
+// addRelay handles POST /api/streams/{key}/relays. The body must be JSON,
+// which browsers cannot send cross-origin without a preflight the API
+// does not allow.
+func (h *HTTPServer) addRelay(w http.ResponseWriter, r *http.Request) {
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	var body struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRelayBody)).Decode(&body); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+	status, err := h.manager.AddRelay(r.PathValue("key"), body.URL)
+	if errors.Is(err, ErrRelayExists) || errors.Is(err, ErrRelayLimit) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newAPIRelay(status))
+}
+
+// registerAdminAPI adds the endpoints that expose the server log or
+// change server state. They are only served on the api_listen listeners,
+// never on the public HLS ones.
+func (h *HTTPServer) registerAdminAPI(mux *http.ServeMux) {
+	// Live log as server-sent events
+	mux.HandleFunc("/api/logs/stream", func(w http.ResponseWriter, r *http.Request) {
+		h.setAPICORS(w, r)
+		streamLogs(w, r)
+	})
+
+	// Add a push target until restart: {"url": "rtmp://host/app/key"}
+	mux.HandleFunc("POST /api/streams/{key}/relays", h.addRelay)
+
+	// Remove a push target added through the API
+	mux.HandleFunc("DELETE /api/streams/{key}/relays/{id}", func(w http.ResponseWriter, r *http.Request) {
+		err := h.manager.RemoveRelay(r.PathValue("key"), r.PathValue("id"))
+		switch {
+		case errors.Is(err, ErrRelayNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrRelayInConfig):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+// historyLength returns the number of samples requested with ?seconds=N,
+// 0 for all. History is sampled once a second. It answers 400 Bad Request for an invalid value.
+func historyLength(w http.ResponseWriter, r *http.Request) (int, bool) {
+	param := r.URL.Query().Get("seconds")
+	if param == "" {
+		return 0, true
+	}
+	seconds, err := strconv.Atoi(param)
+	if err != nil || seconds <= 0 {
+		http.Error(w, "seconds must be a positive integer", http.StatusBadRequest)
+		return 0, false
+	}
+	return seconds, true
+}
+
+// logStreamQueue is the number of entries held for a slow log stream
+// client before further ones are read back from the log buffer
+const logStreamQueue = 256
+
+// logStreamKeepAlive is how often an idle log stream sends a comment, so
+// that proxies don't close it
+const logStreamKeepAlive = 15 * time.Second
+
+// streamLogs sends log entries as server-sent events with the entry's
+// sequence number as event ID. It starts with the buffered entries after
+// the Last-Event-ID header or ?since=N, all of them if neither is set.
+// ?level= skips entries below a level.
+func streamLogs(w http.ResponseWriter, r *http.Request) {
+	since := r.Header.Get("Last-Event-ID")
+	if since == "" {
+		since = r.URL.Query().Get("since")
+	}
+	var seq uint64
+	var err error
+	if since != "" {
+		if seq, err = strconv.ParseUint(since, 10, 64); err != nil {
+			http.Error(w, "since must be a log sequence number", http.StatusBadRequest)
+			return
+		}
+	}
+	level := logger.LevelDebug
+	if name := r.URL.Query().Get("level"); name != "" {
+		if level, err = logger.ParseLevel(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sub, backlog := logger.Subscribe(seq, logStreamQueue)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	rc := http.NewResponseController(w)
+	send := func(entries []logger.Entry) bool {
+		for _, e := range entries {
+			if e.Level < level {
+				continue
+			}
+			data, _ := e.MarshalJSON()
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Seq, data)
+		}
+		return rc.Flush() == nil
+	}
+	if !send(backlog) {
+		return
+	}
+
+	keepAlive := time.NewTicker(logStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok || !send(sub.WithMissed(e)) {
+				return
+			}
+		case <-keepAlive.C:
+			io.WriteString(w, ": keep-alive\n\n")
+			if rc.Flush() != nil {
+				return
+			}
+		}
+	}
+}
+
+// setAPICORS allows the API to be called from the allowed origins
+func (h *HTTPServer) setAPICORS(w http.ResponseWriter, r *http.Request) {
+	list := h.origins.Load().allowlist("")
+	varyOrigin(w, list)
+	if origin := r.Header.Get("Origin"); originAllowed(list, origin) {
+		setCORSHeaders(w, list, origin)
+	}
+}
+
+// writeJSON writes v as the JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Debug("Failed to write API response: %v", err)
+	}
+}
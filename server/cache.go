@@ -0,0 +1,279 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"hash/fnv"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rtmp_server/internal/config"
+)
+
+// cachePolicy holds the Cache-Control lifetimes for HLS resources
+type cachePolicy struct {
+	playlistMaxAge int // seconds
+	segmentMaxAge  int // seconds
+}
+
+func newCachePolicy(cfg config.Config) *cachePolicy {
+	return &cachePolicy{
+		playlistMaxAge: cfg.PlaylistMaxAge,
+		segmentMaxAge:  cfg.SegmentMaxAge,
+	}
+}
+
+// playlistVersion remembers when a playlist body last changed
+type playlistVersion struct {
+	etag    string
+	modTime time.Time
+}
+
+// playlistVersions tracks playlist versions of a stream for Last-Modified
+type playlistVersions struct {
+	mu       sync.Mutex
+	versions map[string]playlistVersion
+}
+
+// update records body as the current content of the named playlist and
+// returns its ETag and the time it last changed
+func (pv *playlistVersions) update(name string, body []byte) (string, time.Time) {
+	h := fnv.New64a()
+	h.Write(body)
+	etag := `"` + strconv.FormatUint(h.Sum64(), 16) + `"`
+
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	if pv.versions == nil {
+		pv.versions = make(map[string]playlistVersion)
+	}
+	v, ok := pv.versions[name]
+	if !ok || v.etag != etag {
+		// HTTP dates have second resolution
+		v = playlistVersion{etag: etag, modTime: time.Now().UTC().Truncate(time.Second)}
+		pv.versions[name] = v
+	}
+	return v.etag, v.modTime
+}
+
+// bufferedResponse captures a handler's response so it can be inspected
+// before anything is sent to the client
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: make(http.Header)}
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// cacheHeaderWriter replaces the muxer's Cache-Control header on
+// successful responses and remembers whether anything was written
+type cacheHeaderWriter struct {
+	http.ResponseWriter
+	cacheControl string
+	etag         string
+	wrote        bool
+}
+
+func (c *cacheHeaderWriter) WriteHeader(status int) {
+	if c.wrote {
+		return
+	}
+	c.wrote = true
+	if status == http.StatusOK {
+		c.Header().Set("Cache-Control", c.cacheControl)
+		c.Header().Set("ETag", c.etag)
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *cacheHeaderWriter) Write(p []byte) (int, error) {
+	if !c.wrote {
+		c.WriteHeader(http.StatusOK)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+// isPlaylist reports whether name is an HLS playlist
+func isPlaylist(name string) bool {
+	return strings.HasSuffix(name, ".m3u8")
+}
+
+// serveCached serves an HLS resource of stream with CDN-friendly caching:
+// playlists get a short max-age, ETag, Last-Modified and optional gzip,
+// segments are immutable and get a long max-age.
+func serveCached(w http.ResponseWriter, r *http.Request, stream *Stream, policy *cachePolicy) {
+	name := path.Base(r.URL.Path)
+	if isPlaylist(name) {
+		servePlaylist(w, r, stream, name, policy)
+		return
+	}
+	serveSegment(w, r, stream, name, policy)
+}
+
+func servePlaylist(w http.ResponseWriter, r *http.Request, stream *Stream, name string, policy *cachePolicy) {
+	buf := newBufferedResponse()
+	stream.Muxer.Handle(buf, r)
+
+	if buf.status != http.StatusOK {
+		copyHeader(w.Header(), buf.header)
+		if buf.status == 0 {
+			buf.status = http.StatusNotFound
+		}
+		w.WriteHeader(buf.status)
+		w.Write(buf.body.Bytes())
+		return
+	}
+
+	body := buf.body.Bytes()
+	if stream.Ended() {
+		body = endPlaylist(body)
+	}
+	etag, modTime := stream.playlists.update(name, body)
+
+	copyHeader(w.Header(), buf.header)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(policy.playlistMaxAge))
+	w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	gzipped := acceptsGzip(r)
+	if gzipped {
+		// A compressed representation needs its own entity tag
+		etag = strings.TrimSuffix(etag, `"`) + `-gz"`
+	}
+	w.Header().Set("ETag", etag)
+
+	if notModified(r, etag, modTime) {
+		w.Header().Del("Content-Type")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if gzipped {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusOK)
+		if r.Method != http.MethodHead {
+			gz := gzip.NewWriter(w)
+			gz.Write(body)
+			gz.Close()
+		}
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// endPlaylist appends #EXT-X-ENDLIST to a media playlist so that players
+// stop polling and play out the remaining segments. Multivariant playlists
+// are returned unchanged.
+func endPlaylist(body []byte) []byte {
+	if !bytes.Contains(body, []byte("#EXT-X-TARGETDURATION")) || bytes.Contains(body, []byte("#EXT-X-ENDLIST")) {
+		return body
+	}
+	ended := make([]byte, 0, len(body)+len("#EXT-X-ENDLIST\n")+1)
+	ended = append(ended, body...)
+	if len(ended) > 0 && ended[len(ended)-1] != '\n' {
+		ended = append(ended, '\n')
+	}
+	return append(ended, "#EXT-X-ENDLIST\n"...)
+}
+
+func serveSegment(w http.ResponseWriter, r *http.Request, stream *Stream, name string, policy *cachePolicy) {
+	// Segment names carry a random per-muxer prefix and never change
+	// content, so the name itself is a strong validator
+	etag := `"` + name + `"`
+	cacheControl := "public, max-age=" + strconv.Itoa(policy.segmentMaxAge) + ", immutable"
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Set("Cache-Control", cacheControl)
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	cw := &cacheHeaderWriter{ResponseWriter: w, cacheControl: cacheControl, etag: etag}
+	stream.Muxer.Handle(cw, r)
+
+	// The muxer writes nothing for segments that have already rotated out
+	if !cw.wrote {
+		w.Header().Set("Cache-Control", "no-cache")
+		http.NotFound(w, r)
+	}
+}
+
+// notModified evaluates conditional request headers. If-None-Match takes
+// precedence over If-Modified-Since as required by RFC 9110.
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, etag)
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modTime.After(t)
+	}
+	return false
+}
+
+// etagMatches reports whether an If-None-Match header matches etag
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsGzip reports whether the client accepts gzip-encoded responses
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc = strings.TrimSpace(enc)
+		if i := strings.Index(enc, ";"); i >= 0 {
+			if strings.TrimSpace(enc[i+1:]) == "q=0" {
+				continue
+			}
+			enc = strings.TrimSpace(enc[:i])
+		}
+		if enc == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
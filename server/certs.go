@@ -0,0 +1,208 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rtmp_server/internal/logger"
+)
+
+const (
+	// certCheckInterval is how often certificate files are checked for changes
+	certCheckInterval = 10 * time.Second
+	// certWarnBefore is how long before expiry a certificate is reported as expiring
+	certWarnBefore = 14 * 24 * time.Hour
+)
+
+// certProvider supplies the certificate of the HTTPS server
+type certProvider interface {
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+	// Expiry returns when the current certificate expires, or the zero
+	// time if none has been obtained yet
+	Expiry() time.Time
+	Close()
+}
+
+// TLSSource selects where the HTTPS certificate comes from: a certificate
+// and key file, or an ACME CA. The zero value means plain HTTP.
+type TLSSource struct {
+	CertFile string
+	KeyFile  string
+	ACME     ACMESettings
+}
+
+// Enabled reports whether the source serves HTTPS
+func (t TLSSource) Enabled() bool {
+	return t.ACME.Enabled || (t.CertFile != "" && t.KeyFile != "")
+}
+
+// newCertProvider creates the provider for src
+func newCertProvider(src TLSSource, httpsAddr string) (certProvider, error) {
+	// Return untyped nils on error so callers can compare with nil
+	if src.ACME.Enabled {
+		p, err := newACMEProvider(src.ACME, httpsAddr)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+	c, err := newCertReloader(src.CertFile, src.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// expiryWarner logs at most once a day while a certificate is close to
+// expiry
+type expiryWarner struct {
+	name     string
+	lastWarn time.Time
+}
+
+func (e *expiryWarner) check(expiry time.Time) {
+	if expiry.IsZero() || !CertExpiring(expiry) || time.Since(e.lastWarn) < 24*time.Hour {
+		return
+	}
+	e.lastWarn = time.Now()
+
+	if time.Now().After(expiry) {
+		logger.Error("TLS certificate %s expired on %s", e.name, expiry.Format("2006-01-02"))
+	} else {
+		logger.Warn("TLS certificate %s expires soon: %s (%s)", e.name, expiry.Format("2006-01-02"), FormatExpiry(expiry))
+	}
+}
+
+// certReloader serves a certificate/key pair from disk and reloads it when
+// either file changes, so renewed certificates (e.g. by certbot) are used
+// without restarting the server
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	cert     atomic.Pointer[tls.Certificate]
+	expiry   atomic.Int64 // Unix seconds of the leaf's NotAfter
+	modTimes [2]time.Time
+	warner   expiryWarner
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newCertReloader loads the certificate pair and starts watching the files
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		warner:   expiryWarner{name: certFile},
+		done:     make(chan struct{}),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	go c.watch()
+	return c, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// Expiry returns when the current certificate expires
+func (c *certReloader) Expiry() time.Time {
+	return time.Unix(c.expiry.Load(), 0)
+}
+
+// Close stops watching the certificate files
+func (c *certReloader) Close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// load reads and parses the pair, then swaps it in atomically
+func (c *certReloader) load() error {
+	modTimes := [2]time.Time{fileModTime(c.certFile), fileModTime(c.keyFile)}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse TLS certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	c.cert.Store(&cert)
+	c.expiry.Store(leaf.NotAfter.Unix())
+	c.modTimes = modTimes
+
+	logger.Info("🔒 TLS certificate loaded for %s, expires %s (%s)",
+		certName(leaf), leaf.NotAfter.Format("2006-01-02"), FormatExpiry(leaf.NotAfter))
+	c.warner.check(leaf.NotAfter)
+	return nil
+}
+
+// watch polls the files and reloads the pair when they change
+func (c *certReloader) watch() {
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			modTimes := [2]time.Time{fileModTime(c.certFile), fileModTime(c.keyFile)}
+			if modTimes != c.modTimes {
+				// Keep serving the old pair if the new one is incomplete,
+				// e.g. the key was written but the certificate not yet
+				if err := c.load(); err != nil {
+					logger.Warn("Keeping current certificate: %v", err)
+				}
+				continue
+			}
+			c.warner.check(c.Expiry())
+		}
+	}
+}
+
+// CertExpiring reports whether a certificate expiring at t should be
+// flagged as close to expiry
+func CertExpiring(t time.Time) bool {
+	return time.Until(t) < certWarnBefore
+}
+
+// FormatExpiry returns a human-readable time until expiry
+func FormatExpiry(t time.Time) string {
+	d := time.Until(t)
+	if d < 0 {
+		return "expired"
+	}
+	days := int(d.Hours() / 24)
+	if days == 0 {
+		return fmt.Sprintf("in %d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("in %d days", days)
+}
+
+// certName returns the most descriptive name of a certificate
+func certName(leaf *x509.Certificate) string {
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0]
+	}
+	return leaf.Subject.CommonName
+}
+
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"rtmp_server/internal/config"
+)
+
+// originPolicy decides which browser origins may fetch playlists and segments
+type originPolicy struct {
+	origins      []string            // Global allowlist, empty allows any origin
+	appOrigins   map[string][]string // Per-application allowlists
+	refererCheck bool
+}
+
+// newOriginPolicy builds an origin policy from configuration
+func newOriginPolicy(cfg config.Config) *originPolicy {
+	p := &originPolicy{
+		origins:      normalizeOrigins(cfg.AllowedOrigins),
+		appOrigins:   make(map[string][]string, len(cfg.AppAllowedOrigins)),
+		refererCheck: cfg.RefererCheck,
+	}
+	for app, origins := range cfg.AppAllowedOrigins {
+		p.appOrigins[app] = normalizeOrigins(origins)
+	}
+	return p
+}
+
+// normalizeOrigins lowercases entries and strips trailing slashes
+func normalizeOrigins(origins []string) []string {
+	result := make([]string, 0, len(origins))
+	for _, o := range origins {
+		o = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(o)), "/")
+		if o != "" {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+// allowlist returns the origins that apply to the given application
+func (p *originPolicy) allowlist(app string) []string {
+	if p == nil {
+		return nil
+	}
+	if list, ok := p.appOrigins[app]; ok {
+		return list
+	}
+	return p.origins
+}
+
+// originAllowed reports whether origin matches an entry of list.
+// Entries may be a full origin ("https://example.com"), a host wildcard
+// ("*.example.com") or "*". An empty list allows everything.
+func originAllowed(list []string, origin string) bool {
+	if len(list) == 0 {
+		return true
+	}
+
+	origin = strings.TrimSuffix(strings.ToLower(origin), "/")
+	host := origin
+	if u, err := url.Parse(origin); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+
+	for _, entry := range list {
+		switch {
+		case entry == "*":
+			return true
+		case strings.HasPrefix(entry, "*."):
+			if strings.HasSuffix(host, entry[1:]) {
+				return true
+			}
+		case entry == origin || entry == host:
+			return true
+		}
+	}
+	return false
+}
+
+// isWildcard reports whether list allows any origin
+func isWildcard(list []string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, entry := range list {
+		if entry == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAccess validates the Origin and Referer headers of r for the given
+// application and sets the matching CORS response headers. It returns false
+// if the request must be rejected.
+func (p *originPolicy) checkAccess(w http.ResponseWriter, r *http.Request, app string) bool {
+	list := p.allowlist(app)
+	varyOrigin(w, list)
+
+	origin := r.Header.Get("Origin")
+	if origin != "" && !originAllowed(list, origin) {
+		return false
+	}
+
+	if p != nil && p.refererCheck {
+		if referer := r.Header.Get("Referer"); referer != "" && !refererAllowed(list, referer, r.Host) {
+			return false
+		}
+	}
+
+	setCORSHeaders(w, list, origin)
+	return true
+}
+
+// refererAllowed reports whether the page that linked to us is allowed.
+// Pages served from our own host are always allowed.
+func refererAllowed(list []string, referer, host string) bool {
+	u, err := url.Parse(referer)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, host) {
+		return true
+	}
+	return originAllowed(list, u.Scheme+"://"+u.Host)
+}
+
+// varyOrigin tells caches that the response depends on the Origin header
+// unless list allows any origin. This includes responses to requests
+// without Origin, which lack Access-Control-Allow-Origin and must not be
+// served to browsers that send one.
+func varyOrigin(w http.ResponseWriter, list []string) {
+	if !isWildcard(list) {
+		w.Header().Add("Vary", "Origin")
+	}
+}
+
+// setCORSHeaders adds the CORS headers for an allowed request
+func setCORSHeaders(w http.ResponseWriter, list []string, origin string) {
+	if isWildcard(list) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else if origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "*")
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+)
+
+// ErrStreamNotFound is returned for operations on a stream that is not active
+var ErrStreamNotFound = errors.New("stream not found")
+
+// StreamDetails describes a stream and its publisher for the detail view
+type StreamDetails struct {
+	StreamInfo
+	App         string
+	Remote      string // Publisher address
+	ConnID      uint64 // RTMP connection ID, as in the conn log field
+	ConnectedAt time.Time
+	Video       string // e.g. "H.264 High 4.1, 1920x1080"; empty without video
+	Audio       string // e.g. "AAC 48000 Hz, stereo"; empty without audio
+}
+
+// publisher is the RTMP connection publishing a stream
+type publisher struct {
+	conn        net.Conn
+	id          uint64
+	connectedAt time.Time
+}
+
+// setPublisher records the connection publishing the stream
+func (s *Stream) setPublisher(conn net.Conn, id uint64) {
+	s.paramsMu.Lock()
+	defer s.paramsMu.Unlock()
+	s.publisher = publisher{conn: conn, id: id, connectedAt: time.Now()}
+}
+
+// StreamDetails returns the details of an active stream
+func (m *Manager) StreamDetails(streamKey string) (StreamDetails, bool) {
+	info := m.GetStreamInfo(streamKey)
+	s := m.activeStream(streamKey)
+	if info == nil || s == nil || !info.Active {
+		return StreamDetails{}, false
+	}
+
+	s.paramsMu.Lock()
+	defer s.paramsMu.Unlock()
+
+	d := StreamDetails{
+		StreamInfo:  *info,
+		App:         s.App,
+		ConnID:      s.publisher.id,
+		ConnectedAt: s.publisher.connectedAt,
+		Video:       describeH264(s.sps),
+	}
+	if s.publisher.conn != nil {
+		d.Remote = s.publisher.conn.RemoteAddr().String()
+	}
+	if s.audioSampleRate > 0 {
+		d.Audio = fmt.Sprintf("AAC %d Hz, %s", s.audioSampleRate, channelLayout(s.audioChannelCount))
+	}
+	return d, true
+}
+
+// DisconnectPublisher closes the connection publishing a stream. Encoders
+// usually reconnect on their own, so this also serves to restart a stream.
+func (m *Manager) DisconnectPublisher(streamKey string) error {
+	s := m.activeStream(streamKey)
+	if s == nil {
+		return ErrStreamNotFound
+	}
+
+	s.paramsMu.Lock()
+	conn := s.publisher.conn
+	s.paramsMu.Unlock()
+	if conn == nil {
+		return ErrStreamNotFound
+	}
+
+	s.log.Info("Disconnecting publisher of stream %s", streamKey)
+	s.kicked.Store(true)
+	return conn.Close()
+}
+
+// h264Profiles names the common H.264 profiles by profile_idc
+var h264Profiles = map[uint8]string{
+	66:  "Baseline",
+	77:  "Main",
+	88:  "Extended",
+	100: "High",
+	110: "High 10",
+	122: "High 4:2:2",
+	244: "High 4:4:4",
+}
+
+// describeH264 summarizes the codec parameters in an SPS
+func describeH264(sps []byte) string {
+	if len(sps) == 0 {
+		return ""
+	}
+	var p h264.SPS
+	if err := p.Unmarshal(sps); err != nil {
+		return "H.264"
+	}
+
+	profile, ok := h264Profiles[p.ProfileIdc]
+	if !ok {
+		profile = fmt.Sprintf("profile %d", p.ProfileIdc)
+	}
+	desc := fmt.Sprintf("H.264 %s %d.%d, %dx%d", profile, p.LevelIdc/10, p.LevelIdc%10, p.Width(), p.Height())
+	if fps := p.FPS(); fps > 0 {
+		desc += fmt.Sprintf(" @ %.4g fps", fps)
+	}
+	return desc
+}
+
+// channelLayout names an audio channel count
+func channelLayout(channels int) string {
+	switch channels {
+	case 1:
+		return "mono"
+	case 2:
+		return "stereo"
+	default:
+		return fmt.Sprintf("%d channels", channels)
+	}
+}
@@ -0,0 +1,506 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"rtmp_server/internal/config"
+	"rtmp_server/internal/logger"
+	"rtmp_server/internal/synth"
+)
+
+// testService runs a Service on loopback ports chosen by the system
+type testService struct {
+	*Service
+	rtmpAddr string
+	httpAddr string
+	apiAddr  string // Empty unless cfg.APIListen was set
+}
+
+// startService starts a service with cfg, listening on free loopback
+// ports, including a separate API listener if cfg.APIListen is set. It is
+// shut down when the test ends, and the server log is printed if the test
+// failed.
+func startService(t *testing.T, cfg config.Config) *testService {
+	t.Helper()
+	cfg.RTMPListen = []string{"127.0.0.1:0"}
+	cfg.HTTPListen = []string{"127.0.0.1:0"}
+	if len(cfg.APIListen) > 0 {
+		cfg.APIListen = []string{"127.0.0.1:0"}
+	}
+
+	s := NewService(cfg)
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start service: %v", err)
+	}
+	seq := logTail()
+	t.Cleanup(func() {
+		s.Stop()
+		if t.Failed() {
+			for _, e := range logger.Since(seq) {
+				t.Logf("server: [%s] %s", e.Level, e.Text())
+			}
+		}
+	})
+
+	s.RTMP.mu.Lock()
+	rtmpAddr := boundAddr(s.RTMP.listeners)
+	s.RTMP.mu.Unlock()
+	s.HTTP.mu.Lock()
+	httpAddr := boundAddr(s.HTTP.listeners)
+	apiAddr := boundAddr(s.HTTP.apiLns)
+	s.HTTP.mu.Unlock()
+	return &testService{Service: s, rtmpAddr: rtmpAddr, httpAddr: httpAddr, apiAddr: apiAddr}
+}
+
+// testConfig returns the default configuration with one-second segments,
+// so that tests see several segments quickly
+func testConfig() config.Config {
+	cfg := config.Default()
+	cfg.SegmentDuration = 1
+	return cfg
+}
+
+// boundAddr returns the address the only listener of ls is bound to
+func boundAddr(ls listenerSet) string {
+	for _, l := range ls {
+		return l.Addr().String()
+	}
+	return ""
+}
+
+// logTail returns the sequence number of the newest log entry
+func logTail() uint64 {
+	entries := logger.GetLogs()
+	if len(entries) == 0 {
+		return 0
+	}
+	return entries[len(entries)-1].Seq
+}
+
+// testPublisher is a synthetic publisher running in the background
+type testPublisher struct {
+	cancel context.CancelFunc
+	done   chan error
+	err    error
+	ended  bool
+}
+
+// publish starts p on the stream key. It is stopped when the test ends.
+func (s *testService) publish(t *testing.T, key string, p *synth.Publisher) *testPublisher {
+	t.Helper()
+	p.URL = fmt.Sprintf("rtmp://%s/live/%s", s.rtmpAddr, key)
+	ctx, cancel := context.WithCancel(context.Background())
+	tp := &testPublisher{cancel: cancel, done: make(chan error, 1)}
+	go func() { tp.done <- p.Publish(ctx) }()
+	t.Cleanup(func() { tp.stop() })
+	return tp
+}
+
+// stop stops publishing and returns the error publishing ended with
+func (tp *testPublisher) stop() error {
+	tp.cancel()
+	_, err := tp.wait(0)
+	return err
+}
+
+// wait waits for publishing to end by itself, at most timeout if it is
+// not zero, and returns whether it ended and with which error
+func (tp *testPublisher) wait(timeout time.Duration) (ended bool, err error) {
+	if !tp.ended {
+		var expired <-chan time.Time
+		if timeout > 0 {
+			expired = time.After(timeout)
+		}
+		select {
+		case tp.err = <-tp.done:
+			tp.ended = true
+		case <-expired:
+			return false, nil
+		}
+	}
+	return true, tp.err
+}
+
+// url returns the HLS URL of path on the service
+func (s *testService) url(path string) string {
+	return "http://" + s.httpAddr + path
+}
+
+// apiURL returns the URL of path on the separate API listener
+func (s *testService) apiURL(path string) string {
+	return "http://" + s.apiAddr + path
+}
+
+// waitFor polls cond until it returns true, failing the test after timeout
+func waitFor(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after %s waiting for %s", timeout, what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// playlist is a parsed HLS playlist
+type playlist struct {
+	variants       []string // Media playlists of a multivariant playlist
+	targetDuration int
+	segments       []playlistSegment
+	ended          bool
+}
+
+type playlistSegment struct {
+	duration time.Duration
+	uri      string
+}
+
+// parsePlaylist parses the tags of a playlist that tests assert on
+func parsePlaylist(body string) (playlist, error) {
+	var p playlist
+	sc := bufio.NewScanner(strings.NewReader(body))
+	if !sc.Scan() || sc.Text() != "#EXTM3U" {
+		return p, errors.New("missing #EXTM3U header")
+	}
+	var duration time.Duration
+	variant := false
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			variant = true
+		case variant && line != "" && !strings.HasPrefix(line, "#"):
+			p.variants = append(p.variants, line)
+			variant = false
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			n, err := strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"))
+			if err != nil {
+				return p, fmt.Errorf("bad target duration: %q", line)
+			}
+			p.targetDuration = n
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value, _, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+			secs, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return p, fmt.Errorf("bad segment duration: %q", line)
+			}
+			duration = time.Duration(secs * float64(time.Second))
+		case line == "#EXT-X-ENDLIST":
+			p.ended = true
+		case line != "" && !strings.HasPrefix(line, "#"):
+			if duration == 0 {
+				return p, fmt.Errorf("segment %s has no #EXTINF", line)
+			}
+			p.segments = append(p.segments, playlistSegment{duration: duration, uri: line})
+			duration = 0
+		}
+	}
+	return p, sc.Err()
+}
+
+// get fetches url and returns the status code and body
+func get(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	return resp.StatusCode, body
+}
+
+// mediaPlaylist fetches the playlist players load for key, following the
+// multivariant index.m3u8 to the media playlist. ok is false while the
+// stream has none.
+func (s *testService) mediaPlaylist(t *testing.T, key string) (p playlist, ok bool) {
+	t.Helper()
+	uri := "index.m3u8"
+	for {
+		status, body := get(t, s.url("/live/"+key+"/"+uri))
+		if status != http.StatusOK {
+			return p, false
+		}
+		var err error
+		if p, err = parsePlaylist(string(body)); err != nil {
+			t.Fatalf("invalid playlist %s: %v\n%s", uri, err, body)
+		}
+		if len(p.variants) == 0 {
+			return p, true
+		}
+		uri = p.variants[0]
+	}
+}
+
+// waitForSegments polls the media playlist of key until it lists at least
+// n segments and returns it
+func (s *testService) waitForSegments(t *testing.T, key string, n int, timeout time.Duration) playlist {
+	t.Helper()
+	var p playlist
+	waitFor(t, timeout, fmt.Sprintf("%d segments in the playlist", n), func() bool {
+		var ok bool
+		p, ok = s.mediaPlaylist(t, key)
+		return ok && len(p.segments) >= n
+	})
+	return p
+}
+
+// checkSegment fetches a segment and checks that it is an MPEG-TS stream
+func (s *testService) checkSegment(t *testing.T, key, uri string) {
+	t.Helper()
+	status, body := get(t, s.url("/live/"+key+"/"+uri))
+	if status != http.StatusOK {
+		t.Fatalf("segment %s: status %d", uri, status)
+	}
+	if len(body) == 0 || len(body)%188 != 0 {
+		t.Fatalf("segment %s: %d bytes is not a whole number of TS packets", uri, len(body))
+	}
+	for i := 0; i < len(body); i += 188 {
+		if body[i] != 0x47 {
+			t.Fatalf("segment %s: no sync byte at offset %d", uri, i)
+		}
+	}
+}
+
+func TestPublishToHLS(t *testing.T) {
+	s := startService(t, testConfig())
+	pub := s.publish(t, "e2e", &synth.Publisher{Video: synth.NewVideo(), Audio: synth.NewAudio()})
+
+	p := s.waitForSegments(t, "e2e", 3, 15*time.Second)
+	if p.targetDuration != 1 {
+		t.Errorf("target duration = %d, want 1", p.targetDuration)
+	}
+	if p.ended {
+		t.Errorf("live playlist has #EXT-X-ENDLIST")
+	}
+	for _, seg := range p.segments {
+		if d := seg.duration - time.Second; d < -50*time.Millisecond || d > 50*time.Millisecond {
+			t.Errorf("segment %s lasts %s, want 1s", seg.uri, seg.duration)
+		}
+	}
+	s.checkSegment(t, "e2e", p.segments[len(p.segments)-1].uri)
+
+	info := s.Manager.GetStreamInfo("e2e")
+	if info == nil || !info.Active {
+		t.Fatalf("stream not active in the manager: %+v", info)
+	}
+	stats := info.Stats
+	if stats.GOPLength != 30 || stats.KeyframeInterval != time.Second {
+		t.Errorf("GOP = %d frames / %s, want 30 frames / 1s", stats.GOPLength, stats.KeyframeInterval)
+	}
+	if stats.Segments < 2 || stats.SegmentAvg != time.Second || stats.SegmentsLong {
+		t.Errorf("segments = %d, avg %s, long %t; want 1s segments", stats.Segments, stats.SegmentAvg, stats.SegmentsLong)
+	}
+	if stats.AudioFrames == 0 || stats.Discontinuities != 0 || stats.DTSErrors != 0 {
+		t.Errorf("audio frames = %d, discontinuities = %d, DTS errors = %d", stats.AudioFrames, stats.Discontinuities, stats.DTSErrors)
+	}
+	if len(info.Alerts) != 0 {
+		t.Errorf("alerts on a healthy stream: %v", info.Alerts)
+	}
+
+	details, ok := s.Manager.StreamDetails("e2e")
+	if !ok || !strings.Contains(details.Video, "128x96 @ 30 fps") || details.App != "live" {
+		t.Errorf("details = %+v", details)
+	}
+
+	// Ending the publish removes the stream
+	if err := pub.stop(); err != nil {
+		t.Fatalf("publisher failed: %v", err)
+	}
+	waitFor(t, 5*time.Second, "the stream to be removed", func() bool {
+		return s.Manager.GetStream("e2e") == nil
+	})
+	if _, ok := s.mediaPlaylist(t, "e2e"); ok {
+		t.Errorf("removed stream still has a playlist")
+	}
+}
+
+func TestStalledAlert(t *testing.T) {
+	events := make(chan alertEvent, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e alertEvent
+		if err := json.NewDecoder(r.Body).Decode(&e); err == nil {
+			events <- e
+		}
+	}))
+	defer hook.Close()
+
+	cfg := testConfig()
+	cfg.StallTimeout = 1
+	cfg.AlertWebhook = hook.URL
+	s := startService(t, cfg)
+	p := &synth.Publisher{Video: synth.NewVideo(), Audio: synth.NewAudio()}
+	s.publish(t, "stall", p)
+	s.waitForSegments(t, "stall", 1, 10*time.Second)
+
+	// A paused encoder stays connected until the alert fires
+	p.Pause()
+	waitFor(t, 5*time.Second, "the stalled alert", func() bool {
+		info := s.Manager.GetStreamInfo("stall")
+		return info != nil && len(info.Alerts) == 1 && info.Alerts[0].Kind == AlertStalled
+	})
+	select {
+	case e := <-events:
+		if e.Event != "alert" || e.Stream != "stall" || e.Kind != AlertStalled {
+			t.Errorf("webhook event = %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook for the stalled alert")
+	}
+
+	p.Resume()
+	waitFor(t, 5*time.Second, "the alert to clear", func() bool {
+		info := s.Manager.GetStreamInfo("stall")
+		return info != nil && len(info.Alerts) == 0
+	})
+	select {
+	case e := <-events:
+		if e.Event != "resolved" || e.Kind != AlertStalled {
+			t.Errorf("webhook event = %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook for the resolved alert")
+	}
+
+	// The publisher read deadline follows the stall timeout
+	cfg.StallTimeout = 30
+	s.Manager.ApplyConfig(cfg)
+	if d := s.Manager.publishTimeout(); d <= 30*time.Second {
+		t.Errorf("publisher read timeout %s, want more than the 30s stall timeout", d)
+	}
+}
+
+func TestLongKeyframeInterval(t *testing.T) {
+	s := startService(t, testConfig())
+	video := synth.NewVideo()
+	video.GOP = 3 * video.FPS
+	s.publish(t, "slow-gop", &synth.Publisher{Video: video, Audio: synth.NewAudio(), Speed: 3})
+
+	p := s.waitForSegments(t, "slow-gop", 2, 15*time.Second)
+	for _, seg := range p.segments {
+		if d := seg.duration - 3*time.Second; d < -50*time.Millisecond || d > 50*time.Millisecond {
+			t.Errorf("segment %s lasts %s, want 3s", seg.uri, seg.duration)
+		}
+	}
+	if p.targetDuration != 3 {
+		t.Errorf("target duration = %d, want 3", p.targetDuration)
+	}
+
+	stats := s.Manager.GetStreamInfo("slow-gop").Stats
+	hint := KeyframeHint(stats)
+	if !stats.SegmentsLong || !strings.Contains(hint, "set keyframe interval to 1s") {
+		t.Errorf("segments long = %t, hint %q", stats.SegmentsLong, hint)
+	}
+}
+
+func TestDisconnectPublisher(t *testing.T) {
+	s := startService(t, testConfig())
+	pub := s.publish(t, "kick", &synth.Publisher{Video: synth.NewVideo()})
+
+	waitFor(t, 5*time.Second, "the stream to start", func() bool {
+		stream := s.Manager.GetStream("kick")
+		return stream != nil && stream.IsMuxerReady()
+	})
+	if err := s.Manager.DisconnectPublisher("kick"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, 5*time.Second, "the stream to be removed", func() bool {
+		return s.Manager.GetStream("kick") == nil
+	})
+	if ended, err := pub.wait(5 * time.Second); !ended || err == nil {
+		t.Errorf("publisher did not notice the disconnect: %v", err)
+	}
+	if err := s.Manager.DisconnectPublisher("kick"); !errors.Is(err, ErrStreamNotFound) {
+		t.Errorf("disconnecting again: %v, want ErrStreamNotFound", err)
+	}
+}
+
+func TestShutdownEndsPlaylist(t *testing.T) {
+	s := startService(t, testConfig())
+	s.publish(t, "drain", &synth.Publisher{Video: synth.NewVideo(), Audio: synth.NewAudio()})
+	s.waitForSegments(t, "drain", 2, 15*time.Second)
+
+	// The viewer fetching the playlist makes shutdown wait for it
+	done := make(chan error, 1)
+	go func() { done <- s.Stop() }()
+
+	waitFor(t, 5*time.Second, "#EXT-X-ENDLIST", func() bool {
+		p, ok := s.mediaPlaylist(t, "drain")
+		if !ok {
+			t.Fatalf("playlist gone during drain")
+		}
+		return p.ended
+	})
+	if err := <-done; err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+	if s.Manager.StreamCount() != 0 {
+		t.Errorf("%d streams left after shutdown", s.Manager.StreamCount())
+	}
+}
+
+func TestLogStreamOnlyOnAPIListen(t *testing.T) {
+	cfg := testConfig()
+	cfg.APIListen = []string{"127.0.0.1:0"}
+	s := startService(t, cfg)
+
+	if status, _ := get(t, s.url("/api/streams")); status != http.StatusNotFound {
+		t.Errorf("API on the HLS listener: status %d, want 404", status)
+	}
+	if status, _ := get(t, s.url("/api/logs/stream")); status != http.StatusNotFound {
+		t.Errorf("log stream on the HLS listener: status %d, want 404", status)
+	}
+
+	// The stream starts with the buffered entries
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, s.apiURL("/api/logs/stream"), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(line, "id: ") {
+		t.Errorf("log stream on the API listener: status %d, first line %q, %v", resp.StatusCode, line, err)
+	}
+}
+
+func TestVaryOrigin(t *testing.T) {
+	cfg := testConfig()
+	cfg.AllowedOrigins = []string{"https://player.example.com"}
+	s := startService(t, cfg)
+	s.publish(t, "cors", &synth.Publisher{Video: synth.NewVideo()})
+	s.waitForSegments(t, "cors", 1, 15*time.Second)
+
+	for _, origin := range []string{"", "https://player.example.com", "https://evil.example.net"} {
+		req, _ := http.NewRequest(http.MethodGet, s.url("/live/cors/index.m3u8"), nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if vary := strings.Join(resp.Header.Values("Vary"), ", "); !strings.Contains(vary, "Origin") {
+			t.Errorf("origin %q: status %d, Vary %q lacks Origin", origin, resp.StatusCode, vary)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"time"
+
+	"rtmp_server/internal/monitor"
+)
+
+// StreamSample is a point in the history of a stream
+type StreamSample struct {
+	Time    time.Time
+	Bitrate int64 // Bytes per second
+	FPS     float64
+	Viewers int
+}
+
+// recordHistory adds a sample to the history of every active stream
+func (m *Manager) recordHistory(now time.Time) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, s := range m.streams {
+		if !s.Active {
+			continue
+		}
+		s.history.Add(StreamSample{
+			Time:    now,
+			Bitrate: s.GetBitrate(),
+			FPS:     s.stats.snapshot().FPS,
+			Viewers: m.viewers.count(s.Key),
+		})
+		s.sampleRelays(now)
+	}
+}
+
+// StreamHistory returns up to n of the most recent samples of a stream,
+// oldest first; n <= 0 returns the whole history. ok is false if there is
+// no such stream.
+func (m *Manager) StreamHistory(streamKey string, n int) (samples []StreamSample, ok bool) {
+	s := m.activeStream(streamKey)
+	if s == nil {
+		return nil, false
+	}
+	return s.history.Last(n), true
+}
+
+// monitorLoop records the system and stream history and runs the
+// stream watchdog once per monitor.HistoryInterval until stop is closed
+func (s *Service) monitorLoop(stop <-chan struct{}) {
+	ticker := time.NewTicker(monitor.HistoryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			monitor.Record(now)
+			s.Manager.recordHistory(now)
+			s.Manager.checkHealth(now)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -1,30 +1,67 @@
 package server
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"golang.org/x/crypto/acme"
+
+	"rtmp_server/internal/config"
 	"rtmp_server/internal/logger"
+	"rtmp_server/internal/monitor"
 )
 
-// HTTPServer serves HLS content
+// HTTPServer serves HLS content and the admin API. The API is served on
+// the HLS listeners unless separate API addresses are configured.
 type HTTPServer struct {
-	addr    string
-	manager *Manager
-	server  *http.Server
-	running bool
-	mu      sync.Mutex
-	useSSL  bool
+	addrs     []string
+	apiAddrs  []string
+	manager   *Manager
+	server    *http.Server
+	listeners listenerSet
+	api       *http.Server // nil when the API is served with HLS
+	apiLns    listenerSet
+	certs     certProvider // nil without TLS
+	source    TLSSource
+	running   bool
+	mu        sync.Mutex
+
+	// apiSeparate hides the API routes from the HLS listeners
+	apiSeparate atomic.Bool
+
+	// Access policy, swapped atomically on config changes
+	origins     atomic.Pointer[originPolicy]
+	playbackACL atomic.Pointer[ipACL]
+	cache       atomic.Pointer[cachePolicy]
 }
 
-// NewHTTPServer creates a new HTTP server for HLS delivery
-func NewHTTPServer(addr string, manager *Manager) *HTTPServer {
-	return &HTTPServer{
-		addr:    addr,
-		manager: manager,
+// NewHTTPServer creates a new HTTP server for HLS delivery on addrs. With
+// apiAddrs, the admin API is served there over plain HTTP instead.
+func NewHTTPServer(addrs, apiAddrs []string, manager *Manager) *HTTPServer {
+	h := &HTTPServer{
+		addrs:    addrs,
+		apiAddrs: apiAddrs,
+		manager:  manager,
 	}
+	h.ApplyConfig(config.Default())
+	return h
+}
+
+// ApplyConfig updates the access and caching policy from configuration.
+// It is safe to call while the server is running.
+func (h *HTTPServer) ApplyConfig(cfg config.Config) {
+	h.origins.Store(newOriginPolicy(cfg))
+	h.playbackACL.Store(newIPACL("playback", cfg.PlaybackAllow, cfg.PlaybackDeny))
+	h.cache.Store(newCachePolicy(cfg))
 }
 
 // createMux creates and returns the HTTP router/mux
@@ -33,13 +70,9 @@ func (h *HTTPServer) createMux() *http.ServeMux {
 
 	// Handle HLS requests: /live/{streamKey}/...
 	mux.HandleFunc("/live/", func(w http.ResponseWriter, r *http.Request) {
-		// Add CORS headers for cross-origin playback
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "*")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		if !h.playbackACL.Load().PermitsAddr(r.RemoteAddr) {
+			logger.With(logger.KeyRemote, r.RemoteAddr).Warn("Playback request from %s rejected by playback rules", r.RemoteAddr)
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
@@ -53,85 +86,105 @@ func (h *HTTPServer) createMux() *http.ServeMux {
 
 		streamKey := parts[0]
 		stream := h.manager.GetStream(streamKey)
-		if stream == nil || !stream.Active || stream.Muxer == nil {
-			http.NotFound(w, r)
+
+		// Check origin and referer for cross-origin playback
+		app := ""
+		if stream != nil {
+			app = stream.App
+		}
+		if !h.origins.Load().checkAccess(w, r, app) {
+			logger.With(logger.KeyStream, streamKey, logger.KeyRemote, r.RemoteAddr).Warn("Blocked %s from origin %q (referer %q) for stream %s",
+				r.Method, r.Header.Get("Origin"), r.Header.Get("Referer"), streamKey)
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
-		// Let the muxer handle the request
-		stream.Muxer.Handle(w, r)
-	})
-
-	// Health check endpoint
-	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
 
-	// Stream list endpoint (JSON)
-	mux.HandleFunc("/api/streams", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		streams := h.manager.GetAllStreams()
-		if len(streams) == 0 {
-			w.Write([]byte("[]"))
+		if stream == nil || !stream.Active || stream.Muxer == nil {
+			http.NotFound(w, r)
 			return
 		}
-		// Simple JSON output
-		w.Write([]byte("["))
-		for i, s := range streams {
-			if i > 0 {
-				w.Write([]byte(","))
+
+		// Enforce viewer limits
+		if err := h.manager.AdmitViewer(streamKey, viewerID(r)); err != nil {
+			status := http.StatusServiceUnavailable
+			if errors.Is(err, ErrStreamViewerLimit) {
+				status = http.StatusTooManyRequests
 			}
-			w.Write([]byte(`{"key":"` + s.Key + `","bitrate":` + formatInt(s.Bitrate) + `}`))
+			logger.With(logger.KeyStream, streamKey, logger.KeyRemote, r.RemoteAddr).Warn("Viewer %s refused for stream %s: %v", r.RemoteAddr, streamKey, err)
+			w.Header().Set("Retry-After", "10")
+			http.Error(w, http.StatusText(status), status)
+			return
 		}
-		w.Write([]byte("]"))
+
+		// Let the muxer handle the request, with caching headers for CDNs
+		serveCached(&meteredWriter{ResponseWriter: w}, r, stream, h.cache.Load())
 	})
 
-	// Stream list endpoint (text, legacy)
-	mux.HandleFunc("/streams", func(w http.ResponseWriter, r *http.Request) {
-		streams := h.manager.GetAllStreams()
-		w.Header().Set("Content-Type", "text/plain")
-		for _, s := range streams {
-			w.Write([]byte(s.Key + "\n"))
+	mux.HandleFunc("/health", handleHealth)
+
+	// The API moves to its own listeners when api_listen is set
+	h.registerAPI(mux, func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if h.apiSeparate.Load() {
+				http.NotFound(w, r)
+				return
+			}
+			next(w, r)
 		}
 	})
 
 	return mux
 }
 
-// formatInt converts int64 to string
-func formatInt(n int64) string {
-	if n == 0 {
-		return "0"
-	}
-	var result []byte
-	negative := n < 0
-	if negative {
-		n = -n
-	}
-	for n > 0 {
-		result = append([]byte{byte('0' + n%10)}, result...)
-		n /= 10
-	}
-	if negative {
-		result = append([]byte{'-'}, result...)
+// createAPIMux creates the mux for the separate API listeners
+func (h *HTTPServer) createAPIMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", handleHealth)
+	h.registerAPI(mux, func(next http.HandlerFunc) http.HandlerFunc { return next })
+	h.registerAdminAPI(mux)
+	return mux
+}
+
+// handleHealth is the health check endpoint
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// viewerID identifies an HLS client by IP address and user agent, so that
+// several players behind the same NAT still count as separate viewers
+func viewerID(r *http.Request) string {
+	ip := r.RemoteAddr
+	if addr, ok := remoteIP(r.RemoteAddr); ok {
+		ip = addr.String()
 	}
-	return string(result)
+	return ip + "|" + r.UserAgent()
 }
 
 // Start starts the HTTP server (no SSL)
 func (h *HTTPServer) Start() error {
-	return h.startServer("", "")
+	return h.startServer(TLSSource{})
 }
 
 // StartWithTLS starts the HTTP server with TLS/SSL
 func (h *HTTPServer) StartWithTLS(certFile, keyFile string) error {
-	return h.startServer(certFile, keyFile)
+	return h.startServer(TLSSource{CertFile: certFile, KeyFile: keyFile})
+}
+
+// StartWithACME starts the HTTP server with a certificate obtained from
+// an ACME CA
+func (h *HTTPServer) StartWithACME(settings ACMESettings) error {
+	settings.Enabled = true
+	return h.startServer(TLSSource{ACME: settings})
 }
 
 // startServer starts the server, optionally with TLS
-func (h *HTTPServer) startServer(certFile, keyFile string) error {
+func (h *HTTPServer) startServer(src TLSSource) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
@@ -139,18 +192,51 @@ func (h *HTTPServer) startServer(certFile, keyFile string) error {
 		return nil
 	}
 
-	mux := h.createMux()
-	h.useSSL = certFile != "" && keyFile != ""
+	srv, listeners, certs, err := h.serve(h.addrs, src)
+	if err != nil {
+		return err
+	}
 
-	h.server = &http.Server{
-		Addr:    h.addr,
-		Handler: mux,
+	h.server = srv
+	h.listeners = listeners
+	h.certs = certs
+	h.source = src
+	h.running = true
+
+	if err := h.updateAPI(h.apiAddrs); err != nil {
+		h.running = false
+		listeners.Close()
+		srv.Close()
+		h.closeCerts()
+		return err
+	}
+	return nil
+}
+
+// serve binds addrs and serves the HLS mux on them in the background.
+// With TLS, the certificate is served through a provider that picks up
+// renewed certificates without a restart.
+func (h *HTTPServer) serve(addrs []string, src TLSSource) (*http.Server, listenerSet, certProvider, error) {
+	srv := &http.Server{Handler: h.createMux(), ConnState: trackConnState}
+	cancelOnShutdown(srv)
+
+	// Bind synchronously so that address errors reach the caller
+	listeners, err := listenAll(addrs)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	// If TLS, configure it
-	if h.useSSL {
+	var certs certProvider
+	if src.Enabled() {
+		certs, err = newCertProvider(src, addrs[0])
+		if err != nil {
+			listeners.Close()
+			return nil, nil, nil, err
+		}
 		tlsConfig := &tls.Config{
-			MinVersion: tls.VersionTLS12,
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: certs.GetCertificate,
 			CipherSuites: []uint16{
 				tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
 				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
@@ -158,39 +244,259 @@ func (h *HTTPServer) startServer(certFile, keyFile string) error {
 				tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
 			},
 		}
-		h.server.TLSConfig = tlsConfig
+		if src.ACME.Enabled {
+			// Answer TLS-ALPN-01 challenges on the HTTPS port
+			tlsConfig.NextProtos = []string{"h2", "http/1.1", acme.ALPNProto}
+		}
+		srv.TLSConfig = tlsConfig
+	}
+
+	for _, listener := range listeners {
+		serveListener(srv, listener, src.Enabled())
+	}
+	if src.Enabled() {
+		logger.Info("🔒 HTTPS server started on %s (SSL enabled)", strings.Join(listeners.addrs(), ", "))
+	} else {
+		logger.Info("HTTP server started on %s", strings.Join(listeners.addrs(), ", "))
 	}
 
+	return srv, listeners, certs, nil
+}
+
+// trackConnState counts open HTTP connections for the monitor
+func trackConnState(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		monitor.AddHTTPConns(1)
+	case http.StateClosed, http.StateHijacked:
+		monitor.AddHTTPConns(-1)
+	}
+}
+
+// meteredWriter counts HLS response bytes as egress for the monitor
+type meteredWriter struct {
+	http.ResponseWriter
+}
+
+func (m *meteredWriter) Write(p []byte) (int, error) {
+	n, err := m.ResponseWriter.Write(p)
+	monitor.AddEgress(int64(n))
+	return n, err
+}
+
+// serveListener serves srv on one listener in the background
+func serveListener(srv *http.Server, listener net.Listener, useSSL bool) {
 	go func() {
 		var err error
-		if h.useSSL {
-			logger.Info("🔒 HTTPS server started on %s (SSL enabled)", h.addr)
-			err = h.server.ListenAndServeTLS(certFile, keyFile)
+		if useSSL {
+			// The certificate comes from TLSConfig.GetCertificate
+			err = srv.ServeTLS(listener, "", "")
 		} else {
-			logger.Info("HTTP server started on %s", h.addr)
-			err = h.server.ListenAndServe()
+			err = srv.Serve(listener)
 		}
-		if err != nil && err != http.ErrServerClosed {
-			logger.Error("HTTP server error: %v", err)
+		if err != nil && err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+			logger.Error("HTTP server error on %s: %v", listener.Addr(), err)
 		}
 	}()
+}
 
-	h.running = true
+// Restart moves the server to new addresses or a new TLS setup. When only
+// addresses change, listeners that stay keep running; otherwise requests in
+// flight on the old server are allowed to finish in the background.
+func (h *HTTPServer) Restart(addrs, apiAddrs []string, src TLSSource) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.running {
+		h.addrs, h.apiAddrs = addrs, apiAddrs
+		return nil
+	}
+
+	var errs []error
+	// ACME redirects challenge requests to the first HTTPS address
+	if src != h.source || (src.ACME.Enabled && addrs[0] != h.addrs[0]) {
+		if err := h.restart(addrs, src); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restart HTTP server: %w", err))
+		}
+	} else if !slices.Equal(addrs, h.addrs) {
+		added, err := h.listeners.update(addrs)
+		if err != nil {
+			h.addrs = h.listeners.addrs()
+			errs = append(errs, fmt.Errorf("failed to rebind HTTP server: %w", err))
+		} else {
+			h.addrs = addrs
+			for _, listener := range added {
+				serveListener(h.server, listener, h.source.Enabled())
+			}
+			logger.Info("HTTP server now listening on %s", strings.Join(h.listeners.addrs(), ", "))
+		}
+	}
+
+	if h.running && !slices.Equal(apiAddrs, h.apiAddrs) {
+		if err := h.updateAPI(apiAddrs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// restart replaces the HLS server with one on addrs using src. The caller
+// must hold h.mu.
+func (h *HTTPServer) restart(addrs []string, src TLSSource) error {
+	oldServer, oldListeners, oldCerts := h.server, h.listeners, h.certs
+
+	// The old listeners must release their ports first if they are reused,
+	// and the old certificate provider its ACME challenge port. A closed
+	// provider keeps serving its current certificate to the old server.
+	reused := false
+	for addr := range oldListeners {
+		reused = reused || sharesPort(addr, addrs)
+	}
+	if reused {
+		oldListeners.Close()
+	}
+	if oldCerts != nil {
+		oldCerts.Close()
+	}
+
+	srv, listeners, certs, err := h.serve(addrs, src)
+	if err != nil {
+		if reused {
+			// The ports are gone now, so the server is effectively down
+			h.running = false
+			h.certs = nil
+			go drainHTTPServer(oldServer)
+			h.stopAPI()
+		} else if oldCerts != nil {
+			logger.Warn("TLS certificate of the running server is no longer reloaded until the next restart")
+		}
+		return err
+	}
+
+	oldListeners.Close()
+	go drainHTTPServer(oldServer)
+
+	h.server = srv
+	h.listeners = listeners
+	h.certs = certs
+	h.addrs = addrs
+	h.source = src
 	return nil
 }
 
-// Stop stops the HTTP server
+// updateAPI moves the API to addrs, or back onto the HLS listeners when
+// addrs is empty. The caller must hold h.mu.
+func (h *HTTPServer) updateAPI(addrs []string) error {
+	switch {
+	case len(addrs) == 0:
+		h.stopAPI()
+		h.apiAddrs = addrs
+		return nil
+
+	case h.api == nil:
+		listeners, err := listenAll(addrs)
+		if err != nil {
+			return fmt.Errorf("failed to start API server: %w", err)
+		}
+		h.api = &http.Server{Handler: h.createAPIMux()}
+		cancelOnShutdown(h.api)
+		h.apiLns = listeners
+		for _, listener := range listeners {
+			serveListener(h.api, listener, false)
+		}
+		h.apiSeparate.Store(true)
+		h.apiAddrs = addrs
+		logger.Info("API server started on %s", strings.Join(listeners.addrs(), ", "))
+		return nil
+
+	default:
+		added, err := h.apiLns.update(addrs)
+		if err != nil {
+			h.apiAddrs = h.apiLns.addrs()
+			return fmt.Errorf("failed to rebind API server: %w", err)
+		}
+		h.apiAddrs = addrs
+		for _, listener := range added {
+			serveListener(h.api, listener, false)
+		}
+		logger.Info("API server now listening on %s", strings.Join(h.apiLns.addrs(), ", "))
+		return nil
+	}
+}
+
+// stopAPI stops the separate API server and serves the API with HLS
+// again. The caller must hold h.mu.
+func (h *HTTPServer) stopAPI() {
+	if h.api == nil {
+		return
+	}
+	h.apiSeparate.Store(false)
+	h.apiLns.Close()
+	go drainHTTPServer(h.api)
+	h.api, h.apiLns = nil, nil
+	logger.Info("API server stopped, API is served on the HLS port")
+}
+
+// cancelOnShutdown cancels the context of srv's requests when srv shuts
+// down, ending responses that never finish by themselves such as the log
+// stream
+func cancelOnShutdown(srv *http.Server) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv.BaseContext = func(net.Listener) context.Context { return ctx }
+	srv.RegisterOnShutdown(cancel)
+}
+
+// drainHTTPServer lets in-flight requests of a replaced server finish
+func drainHTTPServer(srv *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+	}
+}
+
+// Stop stops the HTTP server, waiting up to defaultShutdownTimeout for
+// in-flight requests
 func (h *HTTPServer) Stop() error {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	return h.Shutdown(ctx)
+}
 
+// Shutdown stops accepting requests and waits for in-flight ones, such as
+// segment downloads, to finish. Connections still open when ctx is done
+// are closed.
+func (h *HTTPServer) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
 	if !h.running || h.server == nil {
+		h.mu.Unlock()
 		return nil
 	}
-
-	err := h.server.Close()
 	h.running = false
-	if h.useSSL {
+	srv, api := h.server, h.api
+	useSSL := h.source.Enabled()
+	h.api, h.apiLns = nil, nil
+	h.apiSeparate.Store(false)
+	h.mu.Unlock()
+
+	// Wait without holding h.mu so that status queries don't block
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		srv.Close()
+		logger.Warn("HTTP drain interrupted, open connections were closed: %v", err)
+		err = fmt.Errorf("HTTP shutdown: %w", err)
+	}
+	if api != nil {
+		if apiErr := api.Shutdown(ctx); apiErr != nil {
+			api.Close()
+		}
+	}
+
+	h.mu.Lock()
+	h.closeCerts()
+	h.mu.Unlock()
+
+	if useSSL {
 		logger.Info("HTTPS server stopped")
 	} else {
 		logger.Info("HTTP server stopped")
@@ -198,6 +504,27 @@ func (h *HTTPServer) Stop() error {
 	return err
 }
 
+// closeCerts stops the certificate reloader, if any. The caller must hold h.mu.
+func (h *HTTPServer) closeCerts() {
+	if h.certs != nil {
+		h.certs.Close()
+		h.certs = nil
+	}
+}
+
+// CertExpiry returns when the served TLS certificate expires. ok is false
+// when the server is not running with TLS or no certificate has been
+// obtained from the ACME CA yet.
+func (h *HTTPServer) CertExpiry() (expiry time.Time, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.certs == nil {
+		return time.Time{}, false
+	}
+	expiry = h.certs.Expiry()
+	return expiry, !expiry.IsZero()
+}
+
 // IsRunning returns whether the server is running
 func (h *HTTPServer) IsRunning() bool {
 	h.mu.Lock()
@@ -205,14 +532,23 @@ func (h *HTTPServer) IsRunning() bool {
 	return h.running
 }
 
-// Addr returns the server address
-func (h *HTTPServer) Addr() string {
-	return h.addr
+// Addrs returns the HLS listen addresses
+func (h *HTTPServer) Addrs() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.addrs)
+}
+
+// APIAddrs returns the separate API listen addresses, if any
+func (h *HTTPServer) APIAddrs() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.apiAddrs)
 }
 
 // IsSSL returns whether SSL is enabled
 func (h *HTTPServer) IsSSL() bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	return h.useSSL
+	return h.source.Enabled()
 }
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+)
+
+// listenerSet holds the listeners of one server keyed by address
+type listenerSet map[string]net.Listener
+
+// listenAll binds every address. If one fails, the others are closed again.
+func listenAll(addrs []string) (listenerSet, error) {
+	ls := make(listenerSet, len(addrs))
+	for _, addr := range addrs {
+		if _, ok := ls[addr]; ok {
+			continue
+		}
+		l, err := listen(addr)
+		if err != nil {
+			ls.Close()
+			return nil, err
+		}
+		ls[addr] = l
+	}
+	return ls, nil
+}
+
+// listen binds addr. IPv4 and IPv6 literals bind only that address
+// family, so "[::]:8080" serves IPv6 only; an empty host binds both.
+func listen(addr string) (net.Listener, error) {
+	network := "tcp"
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		if ip, err := netip.ParseAddr(host); err == nil {
+			if ip.Is4() {
+				network = "tcp4"
+			} else {
+				network = "tcp6"
+			}
+		}
+	}
+	return net.Listen(network, addr)
+}
+
+// update binds the addresses in addrs that are not bound yet and closes
+// the listeners whose address is no longer listed. Listeners that stay are
+// left untouched. It returns the new listeners.
+//
+// A new address may need a port held by a listener that is being removed,
+// e.g. when moving from 0.0.0.0:8080 to 127.0.0.1:8080. In that case the
+// removed listeners are closed first, so they are gone even if binding
+// then fails.
+func (ls listenerSet) update(addrs []string) ([]net.Listener, error) {
+	var added []net.Listener
+	var missing []string
+	for _, addr := range addrs {
+		if _, ok := ls[addr]; !ok && !slices.Contains(missing, addr) {
+			missing = append(missing, addr)
+		}
+	}
+
+	removeStale := func() {
+		for addr, l := range ls {
+			if !slices.Contains(addrs, addr) {
+				l.Close()
+				delete(ls, addr)
+			}
+		}
+	}
+
+	for addr := range ls {
+		if !slices.Contains(addrs, addr) && sharesPort(addr, missing) {
+			removeStale()
+			break
+		}
+	}
+
+	bound, err := listenAll(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	removeStale()
+	for addr, l := range bound {
+		ls[addr] = l
+		added = append(added, l)
+	}
+	return added, nil
+}
+
+// Close closes every listener
+func (ls listenerSet) Close() {
+	for addr, l := range ls {
+		l.Close()
+		delete(ls, addr)
+	}
+}
+
+// addrs returns the bound addresses in a stable order
+func (ls listenerSet) addrs() []string {
+	result := make([]string, 0, len(ls))
+	for addr := range ls {
+		result = append(result, addr)
+	}
+	slices.Sort(result)
+	return result
+}
+
+// displayHost returns the host:port clients on this machine use to reach
+// a listen address, e.g. "localhost:8080" for ":8080"
+func displayHost(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip, err := netip.ParseAddr(host); host == "" || (err == nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// sharesPort reports whether addr uses the same port as any of addrs
+func sharesPort(addr string, addrs []string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	for _, other := range addrs {
+		if _, p, err := net.SplitHostPort(other); err == nil && p == port {
+			return true
+		}
+	}
+	return false
+}
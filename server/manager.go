@@ -1,15 +1,19 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"rtmp_server/internal/config"
 	"rtmp_server/internal/logger"
+	"rtmp_server/internal/monitor"
 
 	"github.com/bluenviron/gohlslib"
 	"github.com/bluenviron/gohlslib/pkg/codecs"
+	"github.com/bluenviron/gortmplib"
 	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
 )
 
@@ -20,18 +24,26 @@ type StreamInfo struct {
 	Bitrate   int64 // bytes per second
 	Viewers   int
 	Active    bool
+	Stats     StreamStats
+	Alerts    []Alert // Ongoing problems found by the watchdog
+	Relays    []RelayStatus
 }
 
 // Stream represents a single active stream with its HLS muxer
 type Stream struct {
 	Key       string
+	App       string // RTMP application name, e.g. "live"
 	Muxer     *gohlslib.Muxer
 	StartTime time.Time
 	Active    bool
 
-	// Codec parameters
-	sps []byte
-	pps []byte
+	log *logger.Logger // Adds the stream key to log entries
+
+	// Codec parameters and publisher, read by StreamDetails
+	paramsMu  sync.Mutex
+	sps       []byte
+	pps       []byte
+	publisher publisher
 
 	// Audio config from incoming stream
 	audioSampleRate   int
@@ -40,33 +52,114 @@ type Stream struct {
 	// NTP start time for proper HLS timestamps
 	ntpStart time.Time
 
+	// HLS segmenting, fixed when the stream is created
+	segmentDuration time.Duration
+	segmentCount    int
+
 	// Thread-safe state using atomics
 	muxerReady atomic.Bool
+	ended      atomic.Bool // No more segments will follow; playlists get #EXT-X-ENDLIST
+	kicked     atomic.Bool // The publisher was disconnected on request
+
+	// Playlist versions for ETag/Last-Modified
+	playlists playlistVersions
+
+	// Frame rate, GOP and timestamp health
+	stats *streamStats
+
+	// Bitrate, frame rate and viewers over the last hour
+	history *monitor.History[StreamSample]
+
+	// Alerts from the watchdog
+	health streamHealth
 
 	// For bitrate calculation (protected by separate lock)
 	brateMu    sync.Mutex
 	bytesTotal int64
 	lastUpdate time.Time
 	bitrate    int64
+
+	// Push targets the stream is re-published to
+	relayAudio *gortmplib.Track // Publisher's AAC track, guarded by paramsMu
+	relaysMu   sync.Mutex
+	relays     []*relay
+	relaysOn   bool // Set by StartRelays, cleared by stopRelays
 }
 
+// ErrPublisherLimit is returned when the maximum number of publishers is reached
+var ErrPublisherLimit = errors.New("publisher limit reached")
+
 // Manager handles multiple concurrent streams
 type Manager struct {
 	mu      sync.RWMutex
 	streams map[string]*Stream
 	hlsDir  string
+	viewers *viewerTracker
+
+	// Limits from configuration (0 = unlimited)
+	maxPublishers       int
+	maxViewersPerStream int
+	maxViewers          int
+
+	// Segmenting for new streams
+	segmentDuration time.Duration
+	segmentCount    int
+
+	// Stall and bitrate alerting
+	watchdog atomic.Pointer[watchdogPolicy]
+
+	// Push targets by stream key, from the config file and the API
+	relayConfig map[string][]string
+	relayAPI    map[string][]string
+
+	// Set on shutdown: ended streams are kept so that viewers can fetch
+	// the final playlist and segments until Close
+	draining bool
 }
 
 // NewManager creates a new stream manager
 func NewManager(hlsDir string) *Manager {
-	return &Manager{
-		streams: make(map[string]*Stream),
-		hlsDir:  hlsDir,
+	m := &Manager{
+		streams:         make(map[string]*Stream),
+		hlsDir:          hlsDir,
+		viewers:         newViewerTracker(),
+		segmentDuration: 2 * time.Second,
+		segmentCount:    5,
 	}
+	m.watchdog.Store(newWatchdogPolicy(config.Default()))
+	return m
+}
+
+// ApplyConfig updates stream limits and segment settings from configuration.
+// It is safe to call while streams are active; segment settings only
+// affect streams created afterwards.
+func (m *Manager) ApplyConfig(cfg config.Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.maxPublishers = cfg.MaxPublishers
+	m.maxViewersPerStream = cfg.MaxViewersPerStream
+	m.maxViewers = cfg.MaxViewers
+	if cfg.SegmentDuration > 0 {
+		m.segmentDuration = time.Duration(cfg.SegmentDuration) * time.Second
+	}
+	if cfg.SegmentCount > 0 {
+		m.segmentCount = cfg.SegmentCount
+	}
+	m.watchdog.Store(newWatchdogPolicy(cfg))
+	m.applyRelayConfig(cfg)
+}
+
+// AdmitViewer records an HLS request from client and refuses new viewers
+// once the per-stream or total viewer limit is reached
+func (m *Manager) AdmitViewer(streamKey, client string) error {
+	m.mu.RLock()
+	maxPerStream, maxTotal := m.maxViewersPerStream, m.maxViewers
+	m.mu.RUnlock()
+	return m.viewers.admit(streamKey, client, maxPerStream, maxTotal)
 }
 
 // GetOrCreateStream returns an existing stream or creates a new one
-func (m *Manager) GetOrCreateStream(streamKey string) (*Stream, error) {
+func (m *Manager) GetOrCreateStream(app, streamKey string) (*Stream, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -74,31 +167,80 @@ func (m *Manager) GetOrCreateStream(streamKey string) (*Stream, error) {
 		return s, nil
 	}
 
+	if m.maxPublishers > 0 && m.activeCount() >= m.maxPublishers {
+		return nil, ErrPublisherLimit
+	}
+
 	stream := &Stream{
 		Key:        streamKey,
+		App:        app,
 		StartTime:  time.Now(),
 		Active:     true,
 		lastUpdate: time.Now(),
+		log:        logger.With(logger.KeyStream, streamKey),
+		stats:      newStreamStats(time.Now(), m.segmentDuration),
+		history:    monitor.NewHistory[StreamSample](monitor.HistorySize),
+
+		segmentDuration: m.segmentDuration,
+		segmentCount:    m.segmentCount,
 	}
 
 	m.streams[streamKey] = stream
-	logger.Info("Stream created: %s", streamKey)
+	stream.log.Info("Stream created: %s", streamKey)
 	return stream, nil
 }
 
-// RemoveStream removes a stream from the manager
+// RemoveStream removes a stream from the manager. While draining, the
+// stream is kept until Close.
 func (m *Manager) RemoveStream(streamKey string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if m.draining {
+		return
+	}
 	if s, exists := m.streams[streamKey]; exists {
-		s.Active = false
-		if s.Muxer != nil {
-			s.Muxer.Close()
-		}
-		delete(m.streams, streamKey)
-		logger.Info("Stream removed: %s", streamKey)
+		m.removeLocked(s)
+	}
+}
+
+// removeLocked closes and forgets s; the caller must hold m.mu
+func (m *Manager) removeLocked(s *Stream) {
+	s.Active = false
+	s.stopRelays()
+	if s.Muxer != nil {
+		s.Muxer.Close()
+	}
+	delete(m.streams, s.Key)
+	m.viewers.removeStream(s.Key)
+	s.log.Info("Stream removed: %s", s.Key)
+}
+
+// EndStreams marks every stream as ended for shutdown, so that playlists
+// tell players no more segments will follow, and keeps the streams until
+// Close. It returns the number of viewers watching them.
+func (m *Manager) EndStreams() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.draining = true
+	viewers := 0
+	for _, s := range m.streams {
+		s.ended.Store(true)
+		viewers += m.viewers.count(s.Key)
 	}
+	return viewers
+}
+
+// Close removes all streams after shutdown
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.streams {
+		m.removeLocked(s)
+	}
+	m.draining = false
 }
 
 // GetStreamInfo returns info about a specific stream
@@ -111,7 +253,11 @@ func (m *Manager) GetStreamInfo(streamKey string) *StreamInfo {
 			Key:       s.Key,
 			StartTime: s.StartTime,
 			Bitrate:   s.GetBitrate(),
+			Viewers:   m.viewers.count(s.Key),
 			Active:    s.Active,
+			Stats:     s.Stats(),
+			Alerts:    s.health.current(),
+			Relays:    s.relayStatus(),
 		}
 	}
 	return nil
@@ -129,7 +275,11 @@ func (m *Manager) GetAllStreams() []StreamInfo {
 				Key:       s.Key,
 				StartTime: s.StartTime,
 				Bitrate:   s.GetBitrate(),
+				Viewers:   m.viewers.count(s.Key),
 				Active:    s.Active,
+				Stats:     s.Stats(),
+				Alerts:    s.health.current(),
+				Relays:    s.relayStatus(),
 			})
 		}
 	}
@@ -143,10 +293,25 @@ func (m *Manager) GetStream(streamKey string) *Stream {
 	return m.streams[streamKey]
 }
 
+// activeStream returns a stream if it exists and is active
+func (m *Manager) activeStream(streamKey string) *Stream {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if s := m.streams[streamKey]; s != nil && s.Active {
+		return s
+	}
+	return nil
+}
+
 // StreamCount returns the number of active streams
 func (m *Manager) StreamCount() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
+	return m.activeCount()
+}
+
+// activeCount counts active streams; the caller must hold m.mu
+func (m *Manager) activeCount() int {
 	count := 0
 	for _, s := range m.streams {
 		if s.Active {
@@ -158,6 +323,8 @@ func (m *Manager) StreamCount() int {
 
 // SetVideoParams sets the H264 codec parameters
 func (s *Stream) SetVideoParams(sps, pps []byte) {
+	s.paramsMu.Lock()
+	defer s.paramsMu.Unlock()
 	s.sps = make([]byte, len(sps))
 	s.pps = make([]byte, len(pps))
 	copy(s.sps, sps)
@@ -166,9 +333,11 @@ func (s *Stream) SetVideoParams(sps, pps []byte) {
 
 // SetAudioParams stores the audio configuration from the incoming stream
 func (s *Stream) SetAudioParams(sampleRate, channelCount int) {
+	s.paramsMu.Lock()
+	defer s.paramsMu.Unlock()
 	s.audioSampleRate = sampleRate
 	s.audioChannelCount = channelCount
-	logger.Info("Audio config set: SampleRate=%d, Channels=%d", sampleRate, channelCount)
+	s.log.Info("Audio config set: SampleRate=%d, Channels=%d", sampleRate, channelCount)
 }
 
 // StartMuxer initializes and starts the HLS muxer
@@ -190,11 +359,11 @@ func (s *Stream) StartMuxer() error {
 	channelCount := s.audioChannelCount
 	if sampleRate == 0 {
 		sampleRate = 48000 // OBS default is 48kHz
-		logger.Warn("Using default audio sample rate: 48kHz")
+		s.log.Warn("Using default audio sample rate: 48kHz")
 	}
 	if channelCount == 0 {
 		channelCount = 2 // Stereo
-		logger.Warn("Using default audio channels: stereo")
+		s.log.Warn("Using default audio channels: stereo")
 	}
 
 	audioTrack := &gohlslib.Track{
@@ -209,8 +378,8 @@ func (s *Stream) StartMuxer() error {
 
 	s.Muxer = &gohlslib.Muxer{
 		Variant:         gohlslib.MuxerVariantMPEGTS,
-		SegmentCount:    5,
-		SegmentDuration: 2 * time.Second,
+		SegmentCount:    s.segmentCount,
+		SegmentDuration: s.segmentDuration,
 		VideoTrack:      videoTrack,
 		AudioTrack:      audioTrack,
 	}
@@ -223,7 +392,7 @@ func (s *Stream) StartMuxer() error {
 	// Set NTP start time for synchronized timestamps
 	s.ntpStart = time.Now()
 	s.muxerReady.Store(true)
-	logger.Info("HLS muxer started for stream: %s", s.Key)
+	s.log.Info("HLS muxer started for stream: %s", s.Key)
 	return nil
 }
 
@@ -231,10 +400,18 @@ func (s *Stream) StartMuxer() error {
 func (s *Stream) WriteH264(pts, dts time.Duration, au [][]byte) {
 	defer func() {
 		if rec := recover(); rec != nil {
-			logger.Error("WriteH264 panic: %v", rec)
+			s.log.Error("WriteH264 panic: %v", rec)
 		}
 	}()
 
+	prev, jump, longSeg := s.stats.video(dts, au, time.Now())
+	if jump {
+		s.log.Warn("Video timestamp discontinuity: DTS %s -> %s", prev, dts)
+	}
+	if longSeg {
+		s.log.Warn("⚠ %s", KeyframeHint(s.stats.snapshot()))
+	}
+
 	if !s.muxerReady.Load() || s.Muxer == nil {
 		return
 	}
@@ -246,12 +423,17 @@ func (s *Stream) WriteH264(pts, dts time.Duration, au [][]byte) {
 	}
 	s.updateBitrate(int64(totalBytes))
 
+	s.relayPacket(relayPacket{video: true, pts: pts, dts: dts, au: au})
+
 	err := s.Muxer.WriteH264(s.ntpStart.Add(pts), pts, au)
 	if err != nil {
 		// Suppress common DTS discontinuity errors (non-fatal, common with OBS)
 		errStr := err.Error()
 		if !contains(errStr, "DTS is not monotonically") && !contains(errStr, "unable to extract DTS") {
-			logger.Error("Error writing H264: %v", err)
+			s.log.Error("Error writing H264: %v", err)
+		} else {
+			s.stats.dtsError()
+			s.log.Debug("Suppressed H264 write error: %v", err)
 		}
 	}
 }
@@ -274,19 +456,24 @@ func containsAt(s, substr string) bool {
 func (s *Stream) WriteAAC(pts time.Duration, au []byte) {
 	defer func() {
 		if rec := recover(); rec != nil {
-			logger.Error("WriteAAC panic: %v", rec)
+			s.log.Error("WriteAAC panic: %v", rec)
 		}
 	}()
 
+	if prev, jump := s.stats.audio(pts, time.Now()); jump {
+		s.log.Warn("Audio timestamp discontinuity: PTS %s -> %s", prev, pts)
+	}
+
 	if !s.muxerReady.Load() || s.Muxer == nil {
 		return
 	}
 
 	s.updateBitrate(int64(len(au)))
+	s.relayPacket(relayPacket{pts: pts, aac: au})
 
 	err := s.Muxer.WriteMPEG4Audio(s.ntpStart.Add(pts), pts, [][]byte{au})
 	if err != nil {
-		logger.Error("Error writing AAC: %v", err)
+		s.log.Error("Error writing AAC: %v", err)
 	}
 }
 
@@ -296,6 +483,7 @@ func (s *Stream) updateBitrate(bytes int64) {
 	defer s.brateMu.Unlock()
 
 	s.bytesTotal += bytes
+	monitor.AddIngest(bytes)
 	now := time.Now()
 	elapsed := now.Sub(s.lastUpdate).Seconds()
 
@@ -306,13 +494,34 @@ func (s *Stream) updateBitrate(bytes int64) {
 	}
 }
 
+// bitrateStale is how long after the last completed window the bitrate
+// is considered outdated
+const bitrateStale = 2 * time.Second
+
 // GetBitrate returns the current bitrate in bytes per second
 func (s *Stream) GetBitrate() int64 {
 	s.brateMu.Lock()
 	defer s.brateMu.Unlock()
+
+	// Windows only complete when packets arrive. If they stop, report the
+	// average of the open window, which decays towards zero, rather than
+	// the last value.
+	if elapsed := time.Since(s.lastUpdate); elapsed > bitrateStale {
+		return int64(float64(s.bytesTotal) / elapsed.Seconds())
+	}
 	return s.bitrate
 }
 
+// Stats returns frame rate, GOP and timestamp statistics
+func (s *Stream) Stats() StreamStats {
+	return s.stats.snapshot()
+}
+
+// Ended reports whether the stream has ended and its playlists are final
+func (s *Stream) Ended() bool {
+	return s.ended.Load()
+}
+
 // IsMuxerReady returns whether the muxer is ready to serve
 func (s *Stream) IsMuxerReady() bool {
 	return s.muxerReady.Load()
@@ -0,0 +1,593 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rtmp_server/internal/config"
+	"rtmp_server/internal/logger"
+
+	"github.com/bluenviron/gortmplib"
+	"github.com/bluenviron/gortmplib/pkg/codecs"
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+)
+
+// relayQueue is the number of packets held for a relay that cannot keep
+// up; beyond it packets are dropped and the relay resumes at the next
+// keyframe
+const relayQueue = 512
+
+// maxAPIRelays is the number of targets the API may add to one stream key
+const maxAPIRelays = 8
+
+// Ports dialed when a target URL has none, as encoders do
+const (
+	rtmpDefaultPort  = "1935"
+	rtmpsDefaultPort = "443"
+)
+
+const (
+	relayDialTimeout  = 10 * time.Second
+	relayWriteTimeout = 10 * time.Second
+	relayBackoffMin   = time.Second
+	relayBackoffMax   = 30 * time.Second
+)
+
+// RelayState is the connection state of a relay
+type RelayState string
+
+const (
+	RelayIdle       RelayState = "idle"       // The stream is not live
+	RelayConnecting RelayState = "connecting" // Connecting or waiting for a keyframe
+	RelayConnected  RelayState = "connected"
+	RelayRetrying   RelayState = "retrying" // Waiting to reconnect after an error
+)
+
+// RelayStatus describes a push target of a stream key
+type RelayStatus struct {
+	Key         string
+	ID          string // Identifies the target in the API
+	URL         string // With the stream key masked
+	FromAPI     bool   // Added through the API rather than the config file
+	State       RelayState
+	Bitrate     int64 // Bytes per second sent
+	Reconnects  int
+	LastError   string
+	ErrorAt     time.Time
+	RetryAt     time.Time // Next attempt while retrying
+	ConnectedAt time.Time
+}
+
+var (
+	ErrRelayExists   = errors.New("relay already exists")
+	ErrRelayNotFound = errors.New("relay not found")
+	ErrRelayInConfig = errors.New("relay is set in the config file")
+	ErrRelayLimit    = fmt.Errorf("stream key has %d relays added through the API already", maxAPIRelays)
+)
+
+// relayTarget is a URL a stream key is re-published to
+type relayTarget struct {
+	url     string
+	fromAPI bool
+}
+
+// relayID derives a short stable ID from a target URL, so that the API can
+// refer to targets without repeating their secret stream key
+func relayID(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(sum[:4])
+}
+
+// maskRelayURL hides the stream key, credentials and query of a push URL,
+// e.g. rtmp://a.rtmp.youtube.com/live2/abcd…
+func maskRelayURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "(invalid URL)"
+	}
+	path := u.Path
+	if i := strings.LastIndex(path, "/"); i >= 0 && i < len(path)-1 {
+		key := path[i+1:]
+		if len(key) > 8 {
+			key = key[:4] + "…"
+		} else {
+			key = "…"
+		}
+		path = path[:i+1] + key
+	}
+	masked := u.Scheme + "://" + u.Host + path
+	if u.RawQuery != "" {
+		masked += "?…"
+	}
+	return masked
+}
+
+// relayTargetsLocked returns the targets of a stream key, those from the
+// config file first. The caller must hold m.mu.
+func (m *Manager) relayTargetsLocked(streamKey string) []relayTarget {
+	var targets []relayTarget
+	for _, u := range m.relayConfig[streamKey] {
+		targets = append(targets, relayTarget{url: u})
+	}
+	for _, u := range m.relayAPI[streamKey] {
+		if !slices.Contains(m.relayConfig[streamKey], u) {
+			targets = append(targets, relayTarget{url: u, fromAPI: true})
+		}
+	}
+	return targets
+}
+
+// applyRelayConfig takes the relays from cfg and updates the relays of
+// live streams. The caller must hold m.mu.
+func (m *Manager) applyRelayConfig(cfg config.Config) {
+	m.relayConfig = make(map[string][]string, len(cfg.Relays))
+	for key, urls := range cfg.Relays {
+		m.relayConfig[key] = slices.Clone(urls)
+	}
+	for _, s := range m.streams {
+		s.syncRelays(m.relayTargetsLocked(s.Key))
+	}
+}
+
+// StartRelays starts re-publishing a stream to its targets once its tracks
+// are known
+func (m *Manager) StartRelays(s *Stream) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s.relaysMu.Lock()
+	s.relaysOn = true
+	s.relaysMu.Unlock()
+	s.syncRelays(m.relayTargetsLocked(s.Key))
+}
+
+// AddRelay adds a push target to a stream key until the server restarts.
+// A live stream starts relaying to it immediately.
+func (m *Manager) AddRelay(streamKey, rawURL string) (RelayStatus, error) {
+	if err := config.ValidateRelayURL(rawURL); err != nil {
+		return RelayStatus{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if slices.Contains(m.relayConfig[streamKey], rawURL) || slices.Contains(m.relayAPI[streamKey], rawURL) {
+		return RelayStatus{}, ErrRelayExists
+	}
+	if len(m.relayAPI[streamKey]) >= maxAPIRelays {
+		return RelayStatus{}, ErrRelayLimit
+	}
+	if m.relayAPI == nil {
+		m.relayAPI = make(map[string][]string)
+	}
+	m.relayAPI[streamKey] = append(m.relayAPI[streamKey], rawURL)
+	logger.With(logger.KeyStream, streamKey).Info("Relay added for stream %s: %s", streamKey, maskRelayURL(rawURL))
+
+	if s, ok := m.streams[streamKey]; ok {
+		s.syncRelays(m.relayTargetsLocked(streamKey))
+	}
+	return m.relayStatusLocked(streamKey, relayTarget{url: rawURL, fromAPI: true}), nil
+}
+
+// RemoveRelay removes a push target added with AddRelay and stops
+// relaying to it
+func (m *Manager) RemoveRelay(streamKey, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.relayConfig[streamKey] {
+		if relayID(u) == id {
+			return ErrRelayInConfig
+		}
+	}
+	urls := m.relayAPI[streamKey]
+	i := slices.IndexFunc(urls, func(u string) bool { return relayID(u) == id })
+	if i < 0 {
+		return ErrRelayNotFound
+	}
+	logger.With(logger.KeyStream, streamKey).Info("Relay removed for stream %s: %s", streamKey, maskRelayURL(urls[i]))
+	m.relayAPI[streamKey] = slices.Delete(urls, i, i+1)
+	if len(m.relayAPI[streamKey]) == 0 {
+		delete(m.relayAPI, streamKey)
+	}
+
+	if s, ok := m.streams[streamKey]; ok {
+		s.syncRelays(m.relayTargetsLocked(streamKey))
+	}
+	return nil
+}
+
+// Relays returns the status of every push target, by stream key
+func (m *Manager) Relays() []RelayStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]string, 0, len(m.relayConfig)+len(m.relayAPI))
+	for key := range m.relayConfig {
+		keys = append(keys, key)
+	}
+	for key := range m.relayAPI {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	var result []RelayStatus
+	for _, key := range keys {
+		for _, t := range m.relayTargetsLocked(key) {
+			result = append(result, m.relayStatusLocked(key, t))
+		}
+	}
+	return result
+}
+
+// relayStatusLocked returns the status of a target, idle unless the
+// stream is relaying to it. The caller must hold m.mu.
+func (m *Manager) relayStatusLocked(streamKey string, t relayTarget) RelayStatus {
+	if s, ok := m.streams[streamKey]; ok {
+		for _, st := range s.relayStatus() {
+			if st.ID == relayID(t.url) {
+				return st
+			}
+		}
+	}
+	return RelayStatus{
+		Key:     streamKey,
+		ID:      relayID(t.url),
+		URL:     maskRelayURL(t.url),
+		FromAPI: t.fromAPI,
+		State:   RelayIdle,
+	}
+}
+
+// syncRelays starts relays for new targets and stops those whose target
+// is gone. Nothing starts before StartRelays.
+func (s *Stream) syncRelays(targets []relayTarget) {
+	s.relaysMu.Lock()
+	defer s.relaysMu.Unlock()
+
+	if !s.relaysOn {
+		return
+	}
+	var kept []*relay
+	for _, r := range s.relays {
+		if slices.ContainsFunc(targets, func(t relayTarget) bool { return t.url == r.url }) {
+			kept = append(kept, r)
+		} else {
+			r.stop()
+		}
+	}
+	s.relays = kept
+
+	for _, t := range targets {
+		if slices.ContainsFunc(s.relays, func(r *relay) bool { return r.url == t.url }) {
+			continue
+		}
+		video, audio, ok := s.relayTracks()
+		if !ok {
+			s.log.Warn("Cannot relay stream %s: no H264 parameters", s.Key)
+			return
+		}
+		r := newRelay(s, t, video, audio)
+		s.relays = append(s.relays, r)
+		go r.run()
+	}
+}
+
+// stopRelays stops relaying, e.g. when the publisher leaves
+func (s *Stream) stopRelays() {
+	s.relaysMu.Lock()
+	defer s.relaysMu.Unlock()
+
+	for _, r := range s.relays {
+		r.stop()
+	}
+	s.relays = nil
+	s.relaysOn = false
+}
+
+// SetRelayAudio keeps the publisher's AAC track, which relays announce
+// unchanged
+func (s *Stream) SetRelayAudio(track *gortmplib.Track) {
+	s.paramsMu.Lock()
+	defer s.paramsMu.Unlock()
+	s.relayAudio = track
+}
+
+// relayTracks returns the tracks to announce to relay targets
+func (s *Stream) relayTracks() (video, audio *gortmplib.Track, ok bool) {
+	s.paramsMu.Lock()
+	defer s.paramsMu.Unlock()
+
+	if len(s.sps) == 0 || len(s.pps) == 0 {
+		return nil, nil, false
+	}
+	video = &gortmplib.Track{Codec: &codecs.H264{SPS: s.sps, PPS: s.pps}}
+	return video, s.relayAudio, true
+}
+
+// relayPacket hands a packet to the relays
+func (s *Stream) relayPacket(p relayPacket) {
+	s.relaysMu.Lock()
+	defer s.relaysMu.Unlock()
+
+	for _, r := range s.relays {
+		r.push(p)
+	}
+}
+
+// relayStatus returns the status of the relays
+func (s *Stream) relayStatus() []RelayStatus {
+	s.relaysMu.Lock()
+	defer s.relaysMu.Unlock()
+
+	result := make([]RelayStatus, len(s.relays))
+	for i, r := range s.relays {
+		result[i] = r.status()
+	}
+	return result
+}
+
+// sampleRelays updates the bitrate of the relays
+func (s *Stream) sampleRelays(now time.Time) {
+	s.relaysMu.Lock()
+	defer s.relaysMu.Unlock()
+
+	for _, r := range s.relays {
+		r.sample(now)
+	}
+}
+
+// relayPacket is a video or audio access unit on its way to a relay
+type relayPacket struct {
+	video bool
+	pts   time.Duration
+	dts   time.Duration
+	au    [][]byte // Video
+	aac   []byte   // Audio
+}
+
+// relay re-publishes a stream to one target, reconnecting with backoff
+// until stopped
+type relay struct {
+	relayTarget
+	key   string
+	log   *logger.Logger
+	video *gortmplib.Track
+	audio *gortmplib.Track // nil without audio
+
+	packets chan relayPacket
+	dropped atomic.Bool // Packets were lost; resume at a keyframe
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu          sync.Mutex
+	state       RelayState
+	client      *gortmplib.Client // nil while not connected
+	connectedAt time.Time
+	reconnects  int
+	lastErr     string
+	errAt       time.Time
+	retryAt     time.Time
+	sampleAt    time.Time
+	sampleBytes uint64
+	bitrate     int64
+}
+
+func newRelay(s *Stream, t relayTarget, video, audio *gortmplib.Track) *relay {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &relay{
+		relayTarget: t,
+		key:         s.Key,
+		log:         s.log.With(logger.KeyRelay, relayID(t.url)),
+		video:       video,
+		audio:       audio,
+		packets:     make(chan relayPacket, relayQueue),
+		ctx:         ctx,
+		cancel:      cancel,
+		state:       RelayConnecting,
+	}
+}
+
+// push queues a packet without waiting
+func (r *relay) push(p relayPacket) {
+	select {
+	case r.packets <- p:
+	default:
+		r.dropped.Store(true)
+	}
+}
+
+// stop disconnects and ends run
+func (r *relay) stop() {
+	r.cancel()
+}
+
+// run connects to the target and sends packets until stopped. After an
+// error it waits before reconnecting, twice as long after each failed
+// attempt up to relayBackoffMax.
+func (r *relay) run() {
+	backoff := relayBackoffMin
+	for {
+		connected, err := r.session()
+		if r.ctx.Err() != nil {
+			r.log.Info("Relay to %s stopped", maskRelayURL(r.url))
+			return
+		}
+		if connected {
+			backoff = relayBackoffMin
+		}
+
+		r.mu.Lock()
+		r.state = RelayRetrying
+		r.client = nil
+		r.lastErr = err.Error()
+		r.errAt = time.Now()
+		r.retryAt = r.errAt.Add(backoff)
+		r.mu.Unlock()
+		r.log.Warn("Relay to %s failed: %v; retrying in %s", maskRelayURL(r.url), err, backoff)
+
+		select {
+		case <-r.ctx.Done():
+			r.log.Info("Relay to %s stopped", maskRelayURL(r.url))
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, relayBackoffMax)
+
+		r.mu.Lock()
+		r.state = RelayConnecting
+		r.reconnects++
+		r.mu.Unlock()
+	}
+}
+
+// session makes one connection and sends packets over it, starting at the
+// next keyframe, until it fails or the relay is stopped. connected is
+// true if publishing started.
+func (r *relay) session() (connected bool, err error) {
+	u, err := relayDialURL(r.url)
+	if err != nil {
+		return false, err
+	}
+	c := &gortmplib.Client{URL: u, Publish: true}
+	dialCtx, cancel := context.WithTimeout(r.ctx, relayDialTimeout)
+	err = c.Initialize(dialCtx)
+	cancel()
+	if err != nil {
+		return false, fmt.Errorf("connect: %w", err)
+	}
+	defer c.Close()
+	stop := context.AfterFunc(r.ctx, c.Close)
+	defer stop()
+
+	tracks := []*gortmplib.Track{r.video}
+	if r.audio != nil {
+		tracks = append(tracks, r.audio)
+	}
+	w := &gortmplib.Writer{Conn: c, Tracks: tracks}
+	c.NetConn().SetWriteDeadline(time.Now().Add(relayWriteTimeout))
+	if err := w.Initialize(); err != nil {
+		return false, fmt.Errorf("announce tracks: %w", err)
+	}
+
+	r.mu.Lock()
+	r.state = RelayConnected
+	r.client = c
+	r.connectedAt = time.Now()
+	r.sampleAt = time.Time{}
+	r.mu.Unlock()
+	r.log.Info("Relay to %s connected", maskRelayURL(r.url))
+
+	// Packets queued while disconnected are stale
+	for len(r.packets) > 0 {
+		<-r.packets
+	}
+	r.dropped.Store(false)
+
+	// Timestamps start at the first keyframe sent
+	var offset time.Duration
+	started, synced := false, false
+	for {
+		var p relayPacket
+		select {
+		case <-r.ctx.Done():
+			return true, nil
+		case p = <-r.packets:
+		}
+		if r.dropped.Swap(false) {
+			synced = false
+		}
+
+		c.NetConn().SetWriteDeadline(time.Now().Add(relayWriteTimeout))
+		if p.video {
+			if !synced {
+				if !h264.IDRPresent(p.au) {
+					continue
+				}
+				synced = true
+				if !started {
+					offset, started = p.dts, true
+				}
+			}
+			err = w.WriteH264(r.video, p.pts-offset, p.dts-offset, p.au)
+		} else {
+			if !synced || r.audio == nil || p.pts < offset {
+				continue
+			}
+			err = w.WriteMPEG4Audio(r.audio, p.pts-offset, p.aac)
+		}
+		if err != nil {
+			return true, err
+		}
+	}
+}
+
+// relayDialURL parses a target URL, adding the default port of its scheme
+// if it has none, since gortmplib dials the host as it is
+func relayDialURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Port() == "" {
+		port := rtmpDefaultPort
+		if u.Scheme == "rtmps" {
+			port = rtmpsDefaultPort
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return u, nil
+}
+
+// sample updates the bitrate from the bytes sent since the last sample
+func (r *relay) sample(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.client == nil {
+		r.bitrate = 0
+		return
+	}
+	sent := r.client.BytesSent()
+	if !r.sampleAt.IsZero() {
+		if elapsed := now.Sub(r.sampleAt).Seconds(); elapsed > 0 {
+			r.bitrate = int64(float64(sent-r.sampleBytes) / elapsed)
+		}
+	}
+	r.sampleAt, r.sampleBytes = now, sent
+}
+
+func (r *relay) status() RelayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st := RelayStatus{
+		Key:        r.key,
+		ID:         relayID(r.url),
+		URL:        maskRelayURL(r.url),
+		FromAPI:    r.fromAPI,
+		State:      r.state,
+		Reconnects: r.reconnects,
+		LastError:  r.lastErr,
+		ErrorAt:    r.errAt,
+	}
+	switch r.state {
+	case RelayConnected:
+		st.Bitrate = r.bitrate
+		st.ConnectedAt = r.connectedAt
+	case RelayRetrying:
+		st.RetryAt = r.retryAt
+	}
+	return st
+}
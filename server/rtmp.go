@@ -1,36 +1,64 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"rtmp_server/internal/config"
 	"rtmp_server/internal/logger"
+	"rtmp_server/internal/monitor"
 
 	"github.com/bluenviron/gortmplib"
+	"github.com/bluenviron/gortmplib/pkg/amf0"
 	"github.com/bluenviron/gortmplib/pkg/codecs"
+	"github.com/bluenviron/gortmplib/pkg/message"
 )
 
 // RTMPServer handles incoming RTMP streams
 type RTMPServer struct {
-	addr     string
-	manager  *Manager
-	listener net.Listener
-	running  bool
-	mu       sync.Mutex
-	wg       sync.WaitGroup
+	addrs     []string
+	manager   *Manager
+	listeners listenerSet
+	running   bool
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+
+	// Publish access rules, swapped atomically on config changes
+	publishACL atomic.Pointer[ipACL]
+
+	// Open connections, also per client IP (protected by mu)
+	conns         map[net.Conn]struct{}
+	connsPerIP    map[string]int
+	maxConnsPerIP atomic.Int32
+
+	// Connection IDs tie together the log entries of one connection
+	nextConnID atomic.Uint64
 }
 
-// NewRTMPServer creates a new RTMP server
-func NewRTMPServer(addr string, manager *Manager) *RTMPServer {
+// NewRTMPServer creates a new RTMP server listening on addrs
+func NewRTMPServer(addrs []string, manager *Manager) *RTMPServer {
 	return &RTMPServer{
-		addr:    addr,
-		manager: manager,
+		addrs:      addrs,
+		manager:    manager,
+		conns:      make(map[net.Conn]struct{}),
+		connsPerIP: make(map[string]int),
 	}
 }
 
+// ApplyConfig updates the publish access rules and connection limits
+// from configuration. It is safe to call while the server is running.
+func (r *RTMPServer) ApplyConfig(cfg config.Config) {
+	r.publishACL.Store(newIPACL("publish", cfg.PublishAllow, cfg.PublishDeny))
+	r.maxConnsPerIP.Store(int32(cfg.MaxConnsPerIP))
+}
+
 // Start starts the RTMP server
 func (r *RTMPServer) Start() error {
 	r.mu.Lock()
@@ -40,37 +68,68 @@ func (r *RTMPServer) Start() error {
 		return nil
 	}
 
-	listener, err := net.Listen("tcp", r.addr)
+	listeners, err := listenAll(r.addrs)
 	if err != nil {
 		return fmt.Errorf("failed to start RTMP server: %w", err)
 	}
 
-	r.listener = listener
+	r.listeners = listeners
 	r.running = true
 
-	go r.acceptLoop()
+	for _, listener := range listeners {
+		go r.acceptLoop(listener)
+	}
 
-	logger.Info("RTMP server started on %s", r.addr)
+	logger.Info("RTMP server started on %s", strings.Join(listeners.addrs(), ", "))
 	return nil
 }
 
-// Stop stops the RTMP server
+// Stop stops the RTMP server, waiting up to defaultShutdownTimeout for
+// connection handlers to finish
 func (r *RTMPServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	return r.Shutdown(ctx)
+}
+
+// Shutdown stops accepting connections and closes all open ones, so that
+// publishers stop immediately instead of at their next read deadline. It
+// waits for connection handlers to finish until ctx is done.
+func (r *RTMPServer) Shutdown(ctx context.Context) error {
 	r.mu.Lock()
 	if !r.running {
 		r.mu.Unlock()
 		return nil
 	}
 	r.running = false
+	r.listeners.Close()
+	conns := make([]net.Conn, 0, len(r.conns))
+	for conn := range r.conns {
+		conns = append(conns, conn)
+	}
 	r.mu.Unlock()
 
-	if r.listener != nil {
-		r.listener.Close()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	if len(conns) > 0 {
+		logger.Info("Closed %d RTMP connection(s)", len(conns))
 	}
 
-	r.wg.Wait()
-	logger.Info("RTMP server stopped")
-	return nil
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Info("RTMP server stopped")
+		return nil
+	case <-ctx.Done():
+		logger.Warn("RTMP server stopped with connection handlers still running")
+		return fmt.Errorf("RTMP shutdown: %w", ctx.Err())
+	}
 }
 
 // IsRunning returns whether the server is running
@@ -80,42 +139,132 @@ func (r *RTMPServer) IsRunning() bool {
 	return r.running
 }
 
-// Addr returns the server address
-func (r *RTMPServer) Addr() string {
-	return r.addr
+// Addrs returns the listen addresses
+func (r *RTMPServer) Addrs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.addrs)
+}
+
+// Rebind changes the listen addresses. Listeners on addresses that stay
+// are kept, and connections accepted on removed addresses, including
+// active publishers, are left untouched.
+func (r *RTMPServer) Rebind(addrs []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.running {
+		r.addrs = addrs
+		return nil
+	}
+
+	added, err := r.listeners.update(addrs)
+	if err != nil {
+		r.addrs = r.listeners.addrs()
+		return fmt.Errorf("failed to rebind RTMP server: %w", err)
+	}
+	r.addrs = addrs
+
+	for _, listener := range added {
+		go r.acceptLoop(listener)
+	}
+
+	logger.Info("RTMP server now listening on %s", strings.Join(r.listeners.addrs(), ", "))
+	return nil
 }
 
-func (r *RTMPServer) acceptLoop() {
+func (r *RTMPServer) acceptLoop(listener net.Listener) {
 	for {
-		conn, err := r.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			r.mu.Lock()
 			running := r.running
 			r.mu.Unlock()
-			if !running {
+			if !running || errors.Is(err, net.ErrClosed) {
 				return
 			}
 			logger.Error("Accept error: %v", err)
 			continue
 		}
 
-		r.wg.Add(1)
-		go r.handleConnection(conn)
+		// Refuse before spawning a goroutine so a single client
+		// cannot exhaust the server with idle connections
+		ip := connIP(conn)
+		if !r.acquireConn(conn, ip) {
+			if r.IsRunning() {
+				logger.With(logger.KeyRemote, conn.RemoteAddr().String()).
+					Warn("Connection refused: per-IP limit of %d reached", r.maxConnsPerIP.Load())
+			}
+			conn.Close()
+			continue
+		}
+
+		go r.handleConnection(conn, ip)
 	}
 }
 
-func (r *RTMPServer) handleConnection(conn net.Conn) {
+// acquireConn tracks a new connection from ip, refusing it if over the
+// limit or if the server is shutting down
+func (r *RTMPServer) acquireConn(conn net.Conn, ip string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.running {
+		return false
+	}
+	if limit := int(r.maxConnsPerIP.Load()); limit > 0 && r.connsPerIP[ip] >= limit {
+		return false
+	}
+	r.conns[conn] = struct{}{}
+	r.connsPerIP[ip]++
+	r.wg.Add(1)
+	monitor.AddRTMPConns(1)
+	return true
+}
+
+// releaseConn forgets a closed connection from ip
+func (r *RTMPServer) releaseConn(conn net.Conn, ip string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.conns, conn)
+	monitor.AddRTMPConns(-1)
+	r.connsPerIP[ip]--
+	if r.connsPerIP[ip] <= 0 {
+		delete(r.connsPerIP, ip)
+	}
+}
+
+// connIP returns the remote IP of a connection without the port
+func connIP(conn net.Conn) string {
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+func (r *RTMPServer) handleConnection(conn net.Conn, ip string) {
 	defer r.wg.Done()
+	defer r.releaseConn(conn, ip)
 	defer conn.Close()
 
+	id := r.nextConnID.Add(1)
+	log := logger.With(logger.KeyConn, id, logger.KeyRemote, conn.RemoteAddr().String())
+
 	// Panic recovery to prevent server crash
 	defer func() {
 		if rec := recover(); rec != nil {
-			logger.Error("RTMP handler panic: %v", rec)
+			log.Error("RTMP handler panic: %v", rec)
 		}
 	}()
 
-	logger.Info("Connection from %s", conn.RemoteAddr())
+	if !r.publishACL.Load().PermitsAddr(conn.RemoteAddr().String()) {
+		log.Warn("Connection rejected by publish rules")
+		return
+	}
+
+	log.Info("Connection from %s", conn.RemoteAddr())
 
 	// Set initial read deadline for handshake
 	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
@@ -128,47 +277,63 @@ func (r *RTMPServer) handleConnection(conn net.Conn) {
 	// Initialize connection (handshake)
 	err := sc.Initialize()
 	if err != nil {
-		logger.Error("RTMP handshake failed: %v", err)
+		if r.IsRunning() {
+			log.Error("RTMP handshake failed: %v", err)
+		}
 		return
 	}
+	log.Debug("RTMP handshake complete")
 
 	// Accept connection (get intent: publish or play)
 	err = sc.Accept()
 	if err != nil {
-		logger.Error("RTMP accept failed: %v", err)
+		log.Error("RTMP accept failed: %v", err)
 		return
 	}
+	if sc.URL != nil {
+		log.Debug("RTMP connect to %s, publish=%t", sc.URL.Path, sc.Publish)
+	}
 
 	if sc.Publish {
-		r.handlePublisher(sc, conn)
+		r.handlePublisher(sc, conn, id, log)
 	} else {
-		logger.Warn("Non-publishing connection rejected from %s", conn.RemoteAddr())
+		log.Warn("Non-publishing connection rejected")
 	}
 }
 
-func (r *RTMPServer) handlePublisher(sc *gortmplib.ServerConn, conn net.Conn) {
+func (r *RTMPServer) handlePublisher(sc *gortmplib.ServerConn, conn net.Conn, id uint64, log *logger.Logger) {
 	// Extract stream key from URL path
 	// URL format: rtmp://host/app/streamkey -> Path = /app/streamkey
-	var streamKey string
+	var streamKey, app string
 	if sc.URL != nil {
 		streamKey = extractStreamKey(sc.URL.Path)
+		app = extractApp(sc.URL.Path)
 	} else {
 		streamKey = "default"
-		logger.Warn("No URL in RTMP connection, using default stream key")
+		log.Warn("No URL in RTMP connection, using default stream key")
 	}
 
-	logger.Info("Publisher connected: %s from %s", streamKey, conn.RemoteAddr())
+	log = log.With(logger.KeyStream, streamKey)
+	log.Info("Publisher connected: %s from %s", streamKey, conn.RemoteAddr())
 
 	// Get or create stream
-	stream, err := r.manager.GetOrCreateStream(streamKey)
+	stream, err := r.manager.GetOrCreateStream(app, streamKey)
 	if err != nil {
-		logger.Error("Failed to create stream: %v", err)
+		if errors.Is(err, ErrPublisherLimit) {
+			log.Warn("Publisher refused: %v", err)
+			rejectPublish(sc, err.Error())
+			return
+		}
+		log.Error("Failed to create stream: %v", err)
 		return
 	}
 
+	stream.setPublisher(conn, id)
+
 	defer func() {
+		stream.stopRelays()
 		r.manager.RemoveStream(streamKey)
-		logger.Info("Publisher disconnected: %s", streamKey)
+		log.Info("Publisher disconnected: %s", streamKey)
 	}()
 
 	// Create reader to receive data
@@ -179,12 +344,12 @@ func (r *RTMPServer) handlePublisher(sc *gortmplib.ServerConn, conn net.Conn) {
 	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
 	err = reader.Initialize()
 	if err != nil {
-		logger.Error("Failed to initialize reader: %v", err)
+		log.Error("Failed to initialize reader: %v", err)
 		return
 	}
 
 	tracks := reader.Tracks()
-	logger.Info("Stream %s has %d tracks", streamKey, len(tracks))
+	log.Info("Stream has %d tracks", len(tracks))
 
 	// Find H264 and AAC tracks and set up callbacks
 	var hasVideo bool
@@ -193,7 +358,7 @@ func (r *RTMPServer) handlePublisher(sc *gortmplib.ServerConn, conn net.Conn) {
 		switch codec := track.Codec.(type) {
 		case *codecs.H264:
 			hasVideo = true
-			logger.Info("Stream %s: H264 video track detected", streamKey)
+			log.Info("H264 video track detected")
 
 			// Update muxer with codec parameters if available
 			if len(codec.SPS) > 0 && len(codec.PPS) > 0 {
@@ -205,11 +370,12 @@ func (r *RTMPServer) handlePublisher(sc *gortmplib.ServerConn, conn net.Conn) {
 			})
 
 		case *codecs.MPEG4Audio:
-			logger.Info("Stream %s: AAC audio track detected (SampleRate=%d, Channels=%d)",
-				streamKey, codec.Config.SampleRate, codec.Config.ChannelCount)
+			log.Info("AAC audio track detected (SampleRate=%d, Channels=%d)",
+				codec.Config.SampleRate, codec.Config.ChannelCount)
 
 			// Pass actual audio config to stream for proper HLS muxer setup
 			stream.SetAudioParams(codec.Config.SampleRate, codec.Config.ChannelCount)
+			stream.SetRelayAudio(track)
 
 			reader.OnDataMPEG4Audio(track, func(pts time.Duration, au []byte) {
 				stream.WriteAAC(pts, au)
@@ -218,16 +384,17 @@ func (r *RTMPServer) handlePublisher(sc *gortmplib.ServerConn, conn net.Conn) {
 	}
 
 	if !hasVideo {
-		logger.Warn("Stream %s: No H264 video track found", streamKey)
+		log.Warn("No H264 video track found")
 	}
 
 	// Start HLS muxer if we have video
 	if hasVideo {
 		err = stream.StartMuxer()
 		if err != nil {
-			logger.Error("Failed to start HLS muxer for %s: %v", streamKey, err)
+			log.Error("Failed to start HLS muxer: %v", err)
 			return
 		}
+		r.manager.StartRelays(stream)
 	}
 
 	// Read packets until connection closes
@@ -239,15 +406,40 @@ func (r *RTMPServer) handlePublisher(sc *gortmplib.ServerConn, conn net.Conn) {
 			break
 		}
 
-		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		conn.SetReadDeadline(time.Now().Add(r.manager.publishTimeout()))
 		err = reader.Read()
 		if err != nil {
-			logger.Info("Stream %s ended: %v", streamKey, err)
+			if stream.kicked.Load() {
+				log.Info("Stream %s ended: publisher disconnected on request", streamKey)
+			} else if r.IsRunning() {
+				log.Info("Stream %s ended: %v", streamKey, err)
+			} else {
+				log.Info("Stream %s ended: server shutting down", streamKey)
+			}
 			break
 		}
 	}
 }
 
+// rejectPublish tells the encoder that publishing was refused. The
+// handshake has already acknowledged the publish, so this follows up with
+// an error status that encoders like OBS surface to the user.
+func rejectPublish(sc *gortmplib.ServerConn, description string) {
+	sc.Write(&message.CommandAMF0{
+		ChunkStreamID:   5,
+		Name:            "onStatus",
+		MessageStreamID: 0x1000000,
+		Arguments: []any{
+			nil,
+			amf0.Object{
+				{Key: "level", Value: "error"},
+				{Key: "code", Value: "NetStream.Publish.Rejected"},
+				{Key: "description", Value: description},
+			},
+		},
+	})
+}
+
 func extractStreamKey(path string) string {
 	// Remove leading slashes
 	path = strings.TrimPrefix(path, "/")
@@ -265,3 +457,12 @@ func extractStreamKey(path string) string {
 	}
 	return "default"
 }
+
+// extractApp returns the RTMP application name, i.e. everything before the stream key
+func extractApp(path string) string {
+	path = strings.Trim(path, "/")
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		return path[:i]
+	}
+	return ""
+}
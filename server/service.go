@@ -0,0 +1,344 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"rtmp_server/internal/config"
+	"rtmp_server/internal/logger"
+)
+
+// Service runs the stream manager together with its RTMP and HTTP servers.
+// Both the GUI and headless mode start and stop the server through it.
+type Service struct {
+	Manager *Manager
+	RTMP    *RTMPServer
+	HTTP    *HTTPServer
+
+	mu       sync.Mutex
+	cfg      config.Config
+	reloadMu sync.Mutex // Serializes reloads from the watcher, signals and GUI
+	onReload func(config.Config)
+
+	stopMonitor chan struct{} // Stops monitorLoop; nil when stopped
+}
+
+// NewService creates the manager and servers for the given configuration
+func NewService(cfg config.Config) *Service {
+	manager := NewManager("./hls")
+	s := &Service{
+		Manager: manager,
+		RTMP:    NewRTMPServer(cfg.RTMPAddrs(), manager),
+		HTTP:    NewHTTPServer(cfg.HTTPAddrs(), cfg.APIAddrs(), manager),
+		cfg:     cfg,
+	}
+	s.applyConfig(cfg)
+	return s
+}
+
+// Config returns the configuration the service is running with
+func (s *Service) Config() config.Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// Start starts the RTMP and HTTP servers
+func (s *Service) Start() error {
+	cfg := s.Config()
+	logger.Info("Starting streaming server...")
+
+	if err := s.RTMP.Start(); err != nil {
+		return err
+	}
+
+	var err error
+	switch src := tlsSource(cfg); {
+	case src.ACME.Enabled:
+		err = s.HTTP.StartWithACME(src.ACME)
+	case src.Enabled():
+		err = s.HTTP.StartWithTLS(src.CertFile, src.KeyFile)
+	default:
+		err = s.HTTP.Start()
+	}
+	if err != nil {
+		s.RTMP.Stop()
+		return fmt.Errorf("failed to start HTTP server: %w", err)
+	}
+
+	s.mu.Lock()
+	s.stopMonitor = make(chan struct{})
+	go s.monitorLoop(s.stopMonitor)
+	s.mu.Unlock()
+
+	logger.Info("✅ Server started successfully")
+	for _, addr := range s.RTMP.Addrs() {
+		logger.Info("📡 RTMP URL: rtmp://%s/live/{stream_key}", displayHost(addr))
+	}
+	if cfg.SSLEnabled {
+		logger.Info("🔒 HLS URL:  %s", s.HLSURL("{stream_key}"))
+	} else {
+		for _, addr := range s.HTTP.Addrs() {
+			logger.Info("🎬 HLS URL:  http://%s/live/{stream_key}/index.m3u8", displayHost(addr))
+		}
+	}
+	for _, addr := range s.HTTP.APIAddrs() {
+		logger.Info("🛠  API URL:  http://%s/api/streams", displayHost(addr))
+	}
+	return nil
+}
+
+// defaultShutdownTimeout bounds Stop when no timeout is configured
+const defaultShutdownTimeout = 10 * time.Second
+
+// Stop shuts both servers down gracefully within the configured
+// shutdown_timeout
+func (s *Service) Stop() error {
+	timeout := time.Duration(s.Config().ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+// Shutdown stops the servers gracefully: publishers are disconnected,
+// playlists are marked as ended so players stop cleanly, and in-flight
+// HTTP requests are allowed to finish. Whatever is still open when ctx is
+// done is closed.
+func (s *Service) Shutdown(ctx context.Context) error {
+	start := time.Now()
+	logger.Info("Stopping server...")
+
+	// End the streams first so that RemoveStream keeps them for viewers
+	viewers := s.Manager.EndStreams()
+	rtmpErr := s.RTMP.Shutdown(ctx)
+
+	// Give players one playlist refresh to pick up #EXT-X-ENDLIST
+	if viewers > 0 {
+		linger := time.Duration(s.Config().SegmentDuration) * time.Second
+		logger.Info("Waiting %s for %d viewer(s) to reach the end of the stream", linger, viewers)
+		select {
+		case <-time.After(linger):
+		case <-ctx.Done():
+		}
+	}
+
+	httpErr := s.HTTP.Shutdown(ctx)
+	s.Manager.Close()
+
+	s.mu.Lock()
+	if s.stopMonitor != nil {
+		close(s.stopMonitor)
+		s.stopMonitor = nil
+	}
+	s.mu.Unlock()
+
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err := errors.Join(rtmpErr, httpErr); err != nil {
+		logger.Warn("⏹  Server stopped after %s; drain did not finish in time", elapsed)
+		return err
+	}
+	logger.Info("⏹  Server stopped, drained in %s", elapsed)
+	return nil
+}
+
+// Reload applies cfg to the running service. Access rules, limits, CORS
+// and segment settings for new streams take effect immediately; a listener
+// is only restarted when its address or TLS setup changed, so live streams
+// keep running.
+func (s *Service) Reload(cfg config.Config) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	old := s.Config()
+	s.applyConfig(cfg)
+
+	var errs []error
+	if !slices.Equal(cfg.RTMPAddrs(), old.RTMPAddrs()) {
+		if err := s.RTMP.Rebind(cfg.RTMPAddrs()); err != nil {
+			errs = append(errs, err)
+			cfg.RTMPPort, cfg.RTMPListen = old.RTMPPort, old.RTMPListen
+		}
+	}
+
+	if !slices.Equal(cfg.HTTPAddrs(), old.HTTPAddrs()) || !slices.Equal(cfg.APIAddrs(), old.APIAddrs()) || tlsSource(cfg) != tlsSource(old) {
+		if err := s.HTTP.Restart(cfg.HTTPAddrs(), cfg.APIAddrs(), tlsSource(cfg)); err != nil {
+			errs = append(errs, err)
+			cfg.HTTPListen, cfg.APIListen = old.HTTPListen, old.APIListen
+			cfg.HTTPPort, cfg.SSLEnabled, cfg.SSLDomain, cfg.SSLCert, cfg.SSLKey = old.HTTPPort, old.SSLEnabled, old.SSLDomain, old.SSLCert, old.SSLKey
+			cfg.ACMEEnabled, cfg.ACMEEmail, cfg.ACMEDirectoryURL, cfg.ACMECACert, cfg.ACMECacheDir, cfg.ACMEHTTPPort = old.ACMEEnabled, old.ACMEEmail, old.ACMEDirectoryURL, old.ACMECACert, old.ACMECacheDir, old.ACMEHTTPPort
+		}
+	}
+
+	s.mu.Lock()
+	s.cfg = cfg
+	onReload := s.onReload
+	s.mu.Unlock()
+
+	err := errors.Join(errs...)
+	if err != nil {
+		logger.Error("Configuration reloaded with errors: %v", err)
+	} else {
+		logger.Info("Configuration reloaded")
+	}
+
+	if onReload != nil {
+		onReload(cfg)
+	}
+	return err
+}
+
+// OnReload registers a callback that runs after every reload
+func (s *Service) OnReload(fn func(config.Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onReload = fn
+}
+
+// WatchConfig reloads the configuration whenever the config file changes
+// or the process receives SIGHUP. It returns a function that stops watching.
+func (s *Service) WatchConfig() (stop func()) {
+	stopWatch := config.Watch(2*time.Second, func(cfg config.Config, err error) {
+		logger.Info("Config file changed, reloading")
+		s.reloadIfValid(cfg, err)
+	})
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-hup:
+				logger.Info("Received SIGHUP, reloading configuration")
+				s.reloadIfValid(config.ReadValid())
+			}
+		}
+	}()
+
+	return func() {
+		stopWatch()
+		signal.Stop(hup)
+		close(done)
+	}
+}
+
+func (s *Service) applyConfig(cfg config.Config) {
+	ApplyLogConfig(cfg)
+	s.Manager.ApplyConfig(cfg)
+	s.RTMP.ApplyConfig(cfg)
+	s.HTTP.ApplyConfig(cfg)
+}
+
+// ApplyLogConfig sets the log level and output format and opens, rotates
+// to or closes the log file. Values were validated, so unknown names fall
+// back to the defaults.
+func ApplyLogConfig(cfg config.Config) {
+	level, _ := logger.ParseLevel(cfg.LogLevel)
+	format, _ := logger.ParseFormat(cfg.LogFormat)
+	logger.SetLevel(level)
+	logger.SetFormat(format)
+	if cfg.LogFloodWindow > 0 && cfg.LogFloodBurst > 0 {
+		logger.SetFloodLimits(time.Duration(cfg.LogFloodWindow)*time.Second, cfg.LogFloodBurst)
+	}
+
+	err := logger.SetFile(logger.FileOptions{
+		Path:     cfg.LogFile,
+		MaxSize:  int64(cfg.LogMaxSize) << 20,
+		MaxAge:   time.Duration(cfg.LogMaxAge) * time.Hour,
+		MaxFiles: cfg.LogMaxFiles,
+		Compress: cfg.LogCompress,
+	})
+	if err != nil {
+		logger.Error("Logging to file disabled: %v", err)
+	}
+}
+
+// DisplayHost returns the host that viewers should use in HLS URLs
+func (s *Service) DisplayHost() string {
+	cfg := s.Config()
+	if cfg.SSLEnabled && cfg.SSLDomain != "" {
+		if _, port, err := net.SplitHostPort(cfg.HTTPAddrs()[0]); err == nil && port != "443" {
+			return net.JoinHostPort(cfg.SSLDomain, port)
+		}
+		return cfg.SSLDomain
+	}
+	return displayHost(cfg.HTTPAddrs()[0])
+}
+
+// HLSURL returns the playlist URL viewers use for a stream
+func (s *Service) HLSURL(streamKey string) string {
+	scheme := "http"
+	if s.Config().SSLEnabled {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/live/%s/index.m3u8", scheme, s.DisplayHost(), streamKey)
+}
+
+// RTMPURL returns the URL publishers use for a stream of an RTMP app
+func (s *Service) RTMPURL(app, streamKey string) string {
+	if app == "" {
+		app = "live"
+	}
+	return fmt.Sprintf("rtmp://%s/%s/%s", s.RTMPHost(), app, streamKey)
+}
+
+// RTMPHost returns the host that publishers should use in RTMP URLs
+func (s *Service) RTMPHost() string {
+	return displayHost(s.Config().RTMPAddrs()[0])
+}
+
+// reloadIfValid reloads cfg unless reading or validating it failed, in
+// which case the running configuration is kept
+func (s *Service) reloadIfValid(cfg config.Config, err error) {
+	if err != nil {
+		LogConfigErrors("Keeping current configuration", err)
+		return
+	}
+	s.Reload(cfg)
+}
+
+// LogConfigErrors logs every field error of an invalid configuration
+func LogConfigErrors(context string, err error) {
+	errs := config.AsValidationErrors(err)
+	logger.Error("%s: %d configuration error(s)", context, len(errs))
+	for _, e := range errs {
+		logger.Error("  %s", e.Error())
+	}
+}
+
+// tlsSource returns where the HTTPS certificate comes from for cfg, or
+// the zero TLSSource when SSL is disabled
+func tlsSource(cfg config.Config) TLSSource {
+	switch {
+	case !cfg.SSLEnabled:
+		return TLSSource{}
+	case cfg.ACMEEnabled:
+		acme := ACMESettings{
+			Enabled:      true,
+			Domain:       cfg.SSLDomain,
+			Email:        cfg.ACMEEmail,
+			DirectoryURL: cfg.ACMEDirectoryURL,
+			CACert:       cfg.ACMECACert,
+			CacheDir:     cfg.ACMECacheDir,
+		}
+		if cfg.ACMEHTTPPort != "" {
+			acme.HTTPAddr = ":" + cfg.ACMEHTTPPort
+		}
+		return TLSSource{ACME: acme}
+	default:
+		return TLSSource{CertFile: cfg.SSLCert, KeyFile: cfg.SSLKey}
+	}
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+)
+
+// discontinuityGap is the largest forward timestamp jump that still counts
+// as continuous; backward jumps always count
+const discontinuityGap = time.Second
+
+// segmentTolerance is how much longer than the target a segment may be
+// before the keyframe interval is considered too long
+const segmentTolerance = 1.25
+
+// driftSmoothing weights each new A/V drift sample, smoothing out jitter
+// from packet interleaving and network delivery
+const driftSmoothing = 0.05
+
+// StreamStats describes the timing health of a stream as sent by the
+// encoder
+type StreamStats struct {
+	FPS              float64       // Video frames per second over the last second
+	GOPLength        int           // Frames in the last complete GOP
+	KeyframeInterval time.Duration // Time between the last two keyframes
+	AVDrift          time.Duration // How far audio timestamps run ahead of video, relative to arrival
+	Discontinuities  int64         // Timestamp jumps backwards or by more than a second
+	DTSErrors        int64         // Video frames the muxer refused for bad DTS
+	VideoFrames      int64
+	AudioFrames      int64
+
+	// HLS segments, estimated from keyframes the way the muxer cuts them
+	SegmentTarget time.Duration // Configured segment_duration
+	SegmentLast   time.Duration
+	SegmentAvg    time.Duration
+	SegmentMax    time.Duration
+	Segments      int64
+	SegmentsLong  bool // The last segment overran the target noticeably
+}
+
+// streamStats accumulates StreamStats from the packets of one stream
+type streamStats struct {
+	mu    sync.Mutex
+	start time.Time // Reference for arrival times
+
+	// Frame rate over one-second windows
+	windowStart  time.Time
+	windowFrames int
+	fps          float64
+
+	// GOP structure
+	lastKeyDTS   time.Duration
+	seenKey      bool
+	sinceKey     int // Frames since the last keyframe
+	gopLength    int
+	keyInterval  time.Duration
+	lastVideoDTS time.Duration
+	lastAudioPTS time.Duration
+
+	// Arrival of the last frames, for the watchdog
+	lastVideoAt time.Time
+	lastAudioAt time.Time
+
+	// Segments: the muxer starts a new one at the first keyframe at least
+	// segmentTarget after the start of the current one
+	segmentTarget time.Duration
+	segStart      time.Duration
+	segStarted    bool
+	segments      int64
+	segLast       time.Duration
+	segTotal      time.Duration
+	segMax        time.Duration
+	segLong       bool
+
+	// Offsets between media time and arrival time
+	videoOffset time.Duration
+	audioOffset time.Duration
+	drift       float64 // Smoothed audioOffset - videoOffset in nanoseconds
+	driftSet    bool
+
+	discontinuities int64
+	dtsErrors       int64
+	videoFrames     int64
+	audioFrames     int64
+}
+
+func newStreamStats(now time.Time, segmentTarget time.Duration) *streamStats {
+	return &streamStats{start: now, windowStart: now, segmentTarget: segmentTarget}
+}
+
+// video records a video access unit. It returns the previous DTS, whether
+// this one is discontinuous and whether it ended a segment that overran
+// the target after earlier ones did not.
+func (st *streamStats) video(dts time.Duration, au [][]byte, now time.Time) (prev time.Duration, jump, longSeg bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	prev = st.lastVideoDTS
+	if st.videoFrames > 0 && isDiscontinuous(prev, dts) {
+		st.discontinuities++
+		jump = true
+	}
+	st.lastVideoDTS = dts
+	st.lastVideoAt = now
+	st.videoFrames++
+
+	st.windowFrames++
+	if elapsed := now.Sub(st.windowStart); elapsed >= time.Second {
+		st.fps = float64(st.windowFrames) / elapsed.Seconds()
+		st.windowFrames = 0
+		st.windowStart = now
+	}
+
+	if h264.IDRPresent(au) {
+		longSeg = st.segment(dts)
+		if st.seenKey {
+			st.gopLength = st.sinceKey
+			st.keyInterval = dts - st.lastKeyDTS
+		}
+		st.seenKey = true
+		st.lastKeyDTS = dts
+		st.sinceKey = 0
+	}
+	st.sinceKey++
+
+	st.videoOffset = dts - now.Sub(st.start)
+	return prev, jump, longSeg
+}
+
+// segment tracks segment boundaries at a keyframe. It reports whether a
+// segment ended that is the first of a run of long ones. The caller must
+// hold st.mu.
+func (st *streamStats) segment(dts time.Duration) bool {
+	if !st.segStarted || dts < st.segStart {
+		st.segStart, st.segStarted = dts, true
+		return false
+	}
+	d := dts - st.segStart
+	if d < st.segmentTarget {
+		return false
+	}
+	st.segStart = dts
+	st.segLast = d
+	st.segments++
+	st.segTotal += d
+	st.segMax = max(st.segMax, d)
+
+	wasLong := st.segLong
+	st.segLong = float64(d) > float64(st.segmentTarget)*segmentTolerance
+	return st.segLong && !wasLong
+}
+
+// audio records an audio access unit. It returns the previous PTS and
+// whether this one is discontinuous.
+func (st *streamStats) audio(pts time.Duration, now time.Time) (prev time.Duration, jump bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	prev = st.lastAudioPTS
+	if st.audioFrames > 0 && isDiscontinuous(prev, pts) {
+		st.discontinuities++
+		jump = true
+	}
+	st.lastAudioPTS = pts
+	st.lastAudioAt = now
+	st.audioFrames++
+
+	st.audioOffset = pts - now.Sub(st.start)
+	if st.videoFrames > 0 {
+		sample := float64(st.audioOffset - st.videoOffset)
+		if !st.driftSet {
+			st.drift = sample
+			st.driftSet = true
+		} else {
+			st.drift += driftSmoothing * (sample - st.drift)
+		}
+	}
+	return prev, jump
+}
+
+// dtsError counts a video frame the muxer refused for its DTS
+func (st *streamStats) dtsError() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.dtsErrors++
+}
+
+// arrivals returns when the last video and audio frames arrived; zero if
+// none did
+func (st *streamStats) arrivals() (video, audio time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.lastVideoAt, st.lastAudioAt
+}
+
+// snapshot returns the current statistics
+func (st *streamStats) snapshot() StreamStats {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	fps := st.fps
+	if time.Since(st.windowStart) > 2*time.Second {
+		// No video for a while
+		fps = 0
+	}
+	var segAvg time.Duration
+	if st.segments > 0 {
+		segAvg = st.segTotal / time.Duration(st.segments)
+	}
+	return StreamStats{
+		FPS:              fps,
+		GOPLength:        st.gopLength,
+		KeyframeInterval: st.keyInterval,
+		AVDrift:          time.Duration(st.drift).Round(time.Millisecond),
+		Discontinuities:  st.discontinuities,
+		DTSErrors:        st.dtsErrors,
+		VideoFrames:      st.videoFrames,
+		AudioFrames:      st.audioFrames,
+		SegmentTarget:    st.segmentTarget,
+		SegmentLast:      st.segLast,
+		SegmentAvg:       segAvg,
+		SegmentMax:       st.segMax,
+		Segments:         st.segments,
+		SegmentsLong:     st.segLong,
+	}
+}
+
+// KeyframeHint explains how to fix segments that overrun the target, or
+// returns "" if they don't. The muxer can only cut segments at keyframes,
+// so the encoder's keyframe interval sets their minimum length.
+func KeyframeHint(stats StreamStats) string {
+	if !stats.SegmentsLong {
+		return ""
+	}
+	hint := fmt.Sprintf("segments last %s instead of %s", roundSeconds(stats.SegmentLast), roundSeconds(stats.SegmentTarget))
+	if stats.KeyframeInterval > 0 {
+		hint += fmt.Sprintf(" because keyframes arrive every %s", roundSeconds(stats.KeyframeInterval))
+	}
+	return hint + fmt.Sprintf("; set keyframe interval to %s in your encoder", roundSeconds(stats.SegmentTarget))
+}
+
+// roundSeconds rounds d to a tenth of a second for display, e.g. "2.5s"
+func roundSeconds(d time.Duration) time.Duration {
+	return d.Round(100 * time.Millisecond)
+}
+
+// isDiscontinuous reports whether a timestamp does not follow prev
+func isDiscontinuous(prev, ts time.Duration) bool {
+	return ts < prev || ts-prev > discontinuityGap
+}
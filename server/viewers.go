@@ -0,0 +1,100 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// viewerTimeout is how long a viewer counts as active after its last request.
+// HLS players poll the playlist every segment, so this spans several segments.
+const viewerTimeout = 15 * time.Second
+
+var (
+	// ErrStreamViewerLimit is returned when a stream has reached its viewer limit
+	ErrStreamViewerLimit = errors.New("stream viewer limit reached")
+	// ErrServerViewerLimit is returned when the server has reached its total viewer limit
+	ErrServerViewerLimit = errors.New("server viewer limit reached")
+)
+
+// viewerTracker estimates concurrent HLS viewers. HLS is stateless, so a
+// client counts as a viewer while it keeps requesting playlists or segments.
+type viewerTracker struct {
+	mu        sync.Mutex
+	streams   map[string]map[string]time.Time // stream key -> client id -> last seen
+	total     int
+	lastPrune time.Time
+}
+
+func newViewerTracker() *viewerTracker {
+	return &viewerTracker{
+		streams: make(map[string]map[string]time.Time),
+	}
+}
+
+// admit records a request from client for the given stream. New clients are
+// refused once maxPerStream or maxTotal is reached (0 means unlimited).
+func (t *viewerTracker) admit(streamKey, client string, maxPerStream, maxTotal int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	t.prune(now)
+
+	viewers := t.streams[streamKey]
+	if _, known := viewers[client]; known {
+		viewers[client] = now
+		return nil
+	}
+
+	if maxPerStream > 0 && len(viewers) >= maxPerStream {
+		return ErrStreamViewerLimit
+	}
+	if maxTotal > 0 && t.total >= maxTotal {
+		return ErrServerViewerLimit
+	}
+
+	if viewers == nil {
+		viewers = make(map[string]time.Time)
+		t.streams[streamKey] = viewers
+	}
+	viewers[client] = now
+	t.total++
+	return nil
+}
+
+// prune drops viewers that have not been seen recently, at most once per second
+func (t *viewerTracker) prune(now time.Time) {
+	if now.Sub(t.lastPrune) < time.Second {
+		return
+	}
+	t.lastPrune = now
+
+	for key, viewers := range t.streams {
+		for client, seen := range viewers {
+			if now.Sub(seen) > viewerTimeout {
+				delete(viewers, client)
+				t.total--
+			}
+		}
+		if len(viewers) == 0 {
+			delete(t.streams, key)
+		}
+	}
+}
+
+// count returns the number of active viewers of a stream
+func (t *viewerTracker) count(streamKey string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(time.Now())
+	return len(t.streams[streamKey])
+}
+
+// removeStream forgets all viewers of a stream
+func (t *viewerTracker) removeStream(streamKey string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total -= len(t.streams[streamKey])
+	delete(t.streams, streamKey)
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"rtmp_server/internal/config"
+	"rtmp_server/internal/logger"
+)
+
+// AlertKind identifies a stream health problem
+type AlertKind string
+
+const (
+	AlertStalled    AlertKind = "stalled"     // No data at all
+	AlertNoVideo    AlertKind = "no_video"    // Audio continues without video
+	AlertNoAudio    AlertKind = "no_audio"    // Video continues without audio
+	AlertLowBitrate AlertKind = "low_bitrate" // Below min_bitrate
+)
+
+// Alert is an ongoing health problem of a stream
+type Alert struct {
+	Kind    AlertKind
+	Message string
+	Since   time.Time // When the problem started
+}
+
+// webhookTimeout bounds each alert webhook request
+const webhookTimeout = 5 * time.Second
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// watchdogPolicy holds the watchdog settings, swapped atomically on config
+// changes
+type watchdogPolicy struct {
+	stallTimeout time.Duration
+	minBitrate   int64 // Bytes per second; 0 disables the floor
+	webhook      string
+}
+
+func newWatchdogPolicy(cfg config.Config) *watchdogPolicy {
+	timeout := time.Duration(cfg.StallTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = time.Duration(config.Default().StallTimeout) * time.Second
+	}
+	return &watchdogPolicy{
+		stallTimeout: timeout,
+		minBitrate:   int64(cfg.MinBitrate) * 1000 / 8,
+		webhook:      cfg.AlertWebhook,
+	}
+}
+
+// publishGrace is how long a silent publisher stays connected after the
+// stalled alert is due, so the alert fires before the connection times out
+const publishGrace = 10 * time.Second
+
+// publishTimeout returns the read deadline for publisher connections
+func (m *Manager) publishTimeout() time.Duration {
+	return m.watchdog.Load().stallTimeout + publishGrace
+}
+
+// streamHealth holds the alerts of one stream
+type streamHealth struct {
+	mu       sync.Mutex
+	alerts   []Alert
+	lowSince time.Time // Start of the current run below the bitrate floor
+}
+
+// current returns the ongoing alerts
+func (h *streamHealth) current() []Alert {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.alerts)
+}
+
+// check detects problems from the arrival times of the last video and audio
+// frames and the current bitrate. It returns the alerts that were raised
+// and the ones that cleared since the last check.
+func (h *streamHealth) check(now, start, video, audio time.Time, bitrate int64, p *watchdogPolicy) (raised, cleared []Alert) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var found []Alert
+	last := video
+	if audio.After(last) {
+		last = audio
+	}
+	if last.IsZero() {
+		last = start
+	}
+
+	if now.Sub(last) >= p.stallTimeout {
+		// Stalled covers the other problems
+		found = append(found, Alert{Kind: AlertStalled, Message: "no data received", Since: last})
+		h.lowSince = time.Time{}
+	} else {
+		if !video.IsZero() && now.Sub(video) >= p.stallTimeout {
+			found = append(found, Alert{Kind: AlertNoVideo, Message: "video stopped, audio continues", Since: video})
+		}
+		if !audio.IsZero() && now.Sub(audio) >= p.stallTimeout {
+			found = append(found, Alert{Kind: AlertNoAudio, Message: "audio stopped, video continues", Since: audio})
+		}
+
+		// Encoders vary their bitrate, so only a sustained drop counts
+		if p.minBitrate > 0 && bitrate < p.minBitrate && now.Sub(start) >= p.stallTimeout {
+			if h.lowSince.IsZero() {
+				h.lowSince = now
+			}
+			if now.Sub(h.lowSince) >= p.stallTimeout {
+				found = append(found, Alert{
+					Kind:    AlertLowBitrate,
+					Message: "bitrate below " + FormatBitrate(p.minBitrate),
+					Since:   h.lowSince,
+				})
+			}
+		} else {
+			h.lowSince = time.Time{}
+		}
+	}
+
+	// Keep ongoing alerts as they were raised
+	var alerts []Alert
+	for _, a := range found {
+		if i := slices.IndexFunc(h.alerts, func(old Alert) bool { return old.Kind == a.Kind }); i >= 0 {
+			alerts = append(alerts, h.alerts[i])
+		} else {
+			alerts = append(alerts, a)
+			raised = append(raised, a)
+		}
+	}
+	for _, old := range h.alerts {
+		if !slices.ContainsFunc(found, func(a Alert) bool { return a.Kind == old.Kind }) {
+			cleared = append(cleared, old)
+		}
+	}
+	h.alerts = alerts
+	return raised, cleared
+}
+
+// checkHealth runs the watchdog over the active streams, logging and
+// posting alerts as they are raised and cleared
+func (m *Manager) checkHealth(now time.Time) {
+	policy := m.watchdog.Load()
+
+	m.mu.RLock()
+	streams := make([]*Stream, 0, len(m.streams))
+	for _, s := range m.streams {
+		if s.Active && !s.Ended() {
+			streams = append(streams, s)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, s := range streams {
+		video, audio := s.stats.arrivals()
+		raised, cleared := s.health.check(now, s.StartTime, video, audio, s.GetBitrate(), policy)
+		for _, a := range raised {
+			s.log.Warn("🚨 Stream %s: %s for %s", s.Key, a.Message, now.Sub(a.Since).Round(time.Second))
+			policy.notify("alert", s.Key, a, now)
+		}
+		for _, a := range cleared {
+			s.log.Info("✅ Stream %s recovered: %s", s.Key, a.Message)
+			policy.notify("resolved", s.Key, a, now)
+		}
+	}
+}
+
+// alertEvent is the JSON body posted to the alert webhook
+type alertEvent struct {
+	Event   string    `json:"event"` // "alert" or "resolved"
+	Stream  string    `json:"stream"`
+	Kind    AlertKind `json:"kind"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+	Time    time.Time `json:"time"`
+}
+
+// notify posts an alert event to the webhook in the background
+func (p *watchdogPolicy) notify(event, streamKey string, a Alert, now time.Time) {
+	if p.webhook == "" {
+		return
+	}
+	body, err := json.Marshal(alertEvent{
+		Event:   event,
+		Stream:  streamKey,
+		Kind:    a.Kind,
+		Message: a.Message,
+		Since:   a.Since,
+		Time:    now,
+	})
+	if err != nil {
+		return
+	}
+
+	url := p.webhook
+	go func() {
+		resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			logger.Warn("Alert webhook failed: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			logger.Warn("Alert webhook failed: %s", resp.Status)
+		}
+	}()
+}
+
+// FormatAlert describes an alert with how long it has lasted, e.g.
+// "no data received for 25s"
+func FormatAlert(a Alert) string {
+	return fmt.Sprintf("%s for %s", a.Message, time.Since(a.Since).Round(time.Second))
+}